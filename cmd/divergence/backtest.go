@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/divergence/pkg/backtest"
+	"github.com/divergence/pkg/logger"
+	"github.com/divergence/pkg/output"
+	"github.com/divergence/pkg/ta/divergence_detection"
+)
+
+// eventRecord is a backtest event in the JSON output
+type eventRecord struct {
+	output.Record
+	Entry   float64   `json:"entry"`
+	Returns []float64 `json:"returns"`
+	MFE     float64   `json:"mfe"`
+	MAE     float64   `json:"mae"`
+}
+
+// runBacktest measures the returns after the divergences of a candle file
+func runBacktest(args []string) int {
+	options := backtest.DefaultOptions()
+
+	flags := newFlagSet("backtest")
+	input := addInputFlags(flags)
+	detector := addDetectorFlags(flags, options.Detector)
+	horizons := flags.String("horizons", joinInts(options.Horizons), "comma separated bars after the confirmation the returns are measured at")
+	flags.IntVar(&options.Lookback, "rolling", 0, "re-run the detector on every bar over this many bars, like a live scan. 0 runs it once")
+	outputFlag := flags.String("output", "text", "output format: text or json")
+	simulate := flags.Bool("simulate", false, "trade the divergences and report the trades")
+	simulator := addSimulatorFlags(flags)
+	tradesPath := flags.String("trades", "", "CSV file the trade log is written to")
+	equityPath := flags.String("equity-curve", "", "CSV file the equity curve is written to")
+	if err := parseFlags(flags, args); err != nil {
+		return exitCode(err)
+	}
+	if *outputFlag != "text" && *outputFlag != "json" {
+		return fail("backtest", exitUsage, fmt.Errorf("unknown output format %q, expected text or json", *outputFlag))
+	}
+
+	var err error
+	if options.Horizons, err = parseInts(*horizons); err != nil {
+		return fail("backtest", exitUsage, fmt.Errorf("-horizons: %w", err))
+	}
+	if options.Detector, err = detector.detectorConfig(); err != nil {
+		return failure("backtest", err)
+	}
+	simulatorConfig, err := simulator.simulatorConfig()
+	if err != nil {
+		return failure("backtest", err)
+	}
+	asset, err := input.asset()
+	if err != nil {
+		return failure("backtest", err)
+	}
+
+	logger.SetDebug(false)
+	asset = detector.recent(asset)
+	result, err := backtest.Run(asset, options)
+	if err != nil {
+		return failure("backtest", err)
+	}
+
+	var simulation backtest.Simulation
+	if *simulate {
+		divergences := make([]divergence_detection.Divergence, len(result.Events))
+		for i, event := range result.Events {
+			divergences[i] = event.Divergence
+		}
+		if simulation, err = backtest.Simulate(input.symbolName(), asset, divergences, simulatorConfig); err != nil {
+			return failure("backtest", err)
+		}
+		if err := writeCSV(*tradesPath, func(w io.Writer) error { return backtest.WriteTrades(w, simulation.Trades) }); err != nil {
+			return failure("backtest", err)
+		}
+		if err := writeCSV(*equityPath, func(w io.Writer) error { return backtest.WriteEquity(w, simulation.Equity) }); err != nil {
+			return failure("backtest", err)
+		}
+	}
+
+	if *outputFlag == "text" {
+		err = backtest.WriteTable(os.Stdout, result)
+		if err == nil && *simulate {
+			fmt.Fprintf(os.Stdout, "\n%d divergences not traded\n", simulation.Skipped)
+			err = backtest.WriteReport(os.Stdout, backtest.NewReport(simulation))
+		}
+	} else {
+		events := make([]eventRecord, len(result.Events))
+		for i, event := range result.Events {
+			events[i] = eventRecord{
+				Record:  output.NewRecord(input.symbolName(), asset.Interval, event.Divergence),
+				Entry:   event.Entry,
+				Returns: event.Returns,
+				MFE:     event.MFE,
+				MAE:     event.MAE,
+			}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		report := map[string]interface{}{"horizons": result.Horizons, "stats": result.Stats, "events": events}
+		if *simulate {
+			report["skipped"] = simulation.Skipped
+			report["report"] = backtest.NewReport(simulation)
+		}
+		err = encoder.Encode(report)
+	}
+	if err != nil {
+		return failure("backtest", err)
+	}
+	return exitOK
+}
+
+// writeCSV writes to the file at path with write, nothing is written when path is empty
+func writeCSV(path string, write func(w io.Writer) error) error {
+	if path == "" {
+		return nil
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// parseInts parses a comma separated list of numbers and ranges like 2-6
+func parseInts(value string) ([]int, error) {
+	ints := []int{}
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		from, to, isRange := strings.Cut(field, "-")
+		if !isRange {
+			to = from
+		}
+		first, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", field)
+		}
+		last, err := strconv.Atoi(to)
+		if err != nil || last < first {
+			return nil, fmt.Errorf("invalid range %q", field)
+		}
+		for n := first; n <= last; n++ {
+			ints = append(ints, n)
+		}
+	}
+	return ints, nil
+}
+
+func joinInts(ints []int) string {
+	fields := make([]string, len(ints))
+	for i, n := range ints {
+		fields[i] = strconv.Itoa(n)
+	}
+	return strings.Join(fields, ",")
+}
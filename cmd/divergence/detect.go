@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+
+	"github.com/divergence/pkg/logger"
+	"github.com/divergence/pkg/output"
+	"github.com/divergence/pkg/ta/divergence_detection"
+)
+
+// runDetect prints the divergences of one candle file
+func runDetect(args []string) int {
+	flags := newFlagSet("detect")
+	input := addInputFlags(flags)
+	detector := addDetectorFlags(flags, divergence_detection.DefaultDetectorConfig())
+	outputFlag := flags.String("output", "text", "output format: text, json, ndjson or csv")
+	out := flags.String("out", "", "file the divergences are written to, stdout when empty")
+	if err := parseFlags(flags, args); err != nil {
+		return exitCode(err)
+	}
+	format, err := output.ParseFormat(*outputFlag)
+	if err != nil {
+		return fail("detect", exitUsage, err)
+	}
+
+	config, err := detector.detectorConfig()
+	if err != nil {
+		return failure("detect", err)
+	}
+	asset, err := input.asset()
+	if err != nil {
+		return failure("detect", err)
+	}
+
+	logger.SetDebug(false)
+	d, err := divergence_detection.NewDetector(config)
+	if err != nil {
+		return failure("detect", err)
+	}
+	divergences, err := d.DetectAsset(asset)
+	if err != nil {
+		return failure("detect", err)
+	}
+
+	records := make([]output.Record, len(divergences))
+	for i, divergence := range divergences {
+		records[i] = output.NewRecord(input.symbolName(), asset.Interval, divergence)
+	}
+	if err := writeOutput(*out, format, records); err != nil {
+		return failure("detect", err)
+	}
+	return exitOK
+}
+
+// writeOutput writes records to the file at path, or to stdout when path is empty
+func writeOutput(path string, format output.Format, records []output.Record) error {
+	if path == "" {
+		return output.Write(os.Stdout, format, records)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := output.Write(file, format, records); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
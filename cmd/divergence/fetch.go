@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/divergence/pkg/exchange"
+	"github.com/divergence/pkg/feed"
+	"github.com/divergence/pkg/models"
+	"github.com/divergence/pkg/store"
+)
+
+// runFetch downloads the candles of a symbol into a candle file or a store. A store only downloads the
+// candles it is missing
+func runFetch(args []string) int {
+	client := exchange.NewBybitClient()
+
+	flags := newFlagSet("fetch")
+	exchangeName := flags.String("exchange", "bybit", "exchange to download from: bybit")
+	flags.StringVar(&client.Category, "category", client.Category, "bybit category: linear, inverse or spot")
+	flags.StringVar(&client.BaseURL, "url", client.BaseURL, "base URL of the exchange API")
+	symbol := flags.String("symbol", "", "symbol to download, like BTCUSDT")
+	intervalFlag := flags.String("interval", "4h", "timeframe of the candles like 15m, 4h or 1d")
+	fromFlag := flags.String("from", "", "first day or time to download, like 2024-10-01 or 2024-10-01T08:00:00Z. Empty continues a store from its first candle")
+	toFlag := flags.String("to", "", "day or time to download up to, excluded. Empty downloads up to now, or the last closed candle into a store")
+	format := flags.String("format", "bybit", "format of the file: bybit, ndjson or csv")
+	dir := flags.String("out-dir", "data", "directory the file is written to, named <symbol>-<interval>.<ext>")
+	out := flags.String("out", "", "file to write instead of one in -out-dir")
+	storePath := flags.String("store", "", "store to add the candles to instead of writing a file")
+	if err := parseFlags(flags, args); err != nil {
+		return exitCode(err)
+	}
+
+	if *exchangeName != client.Name() {
+		return fail("fetch", exitUsage, fmt.Errorf("unknown exchange %q", *exchangeName))
+	}
+	if *symbol == "" {
+		return fail("fetch", exitUsage, errors.New("-symbol is required"))
+	}
+	interval, err := models.ParseInterval(*intervalFlag)
+	if err != nil {
+		return fail("fetch", exitUsage, err)
+	}
+	from, err := parseDate(*fromFlag)
+	if err == nil && from.IsZero() && *storePath == "" {
+		err = errors.New("a start is required")
+	}
+	if err != nil {
+		return fail("fetch", exitUsage, fmt.Errorf("-from: %w", err))
+	}
+	to, err := parseDate(*toFlag)
+	if err != nil {
+		return fail("fetch", exitUsage, fmt.Errorf("-to: %w", err))
+	}
+
+	encoder, extension, err := encoderByName(*format, *symbol, client.Category)
+	if err != nil && *storePath == "" {
+		return fail("fetch", exitUsage, err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *storePath != "" {
+		key := store.Key{Exchange: client.Name(), Symbol: *symbol, Interval: interval}
+		return fetchMissing(ctx, client, *storePath, key, from, to)
+	}
+
+	candles, err := client.Candles(ctx, *symbol, interval, from, to)
+	if err != nil {
+		return failure("fetch", err)
+	}
+
+	path := *out
+	if path == "" {
+		if err := os.MkdirAll(*dir, 0755); err != nil {
+			return failure("fetch", err)
+		}
+		path = filepath.Join(*dir, fmt.Sprintf("%s-%s%s", strings.ToLower(*symbol), models.FormatInterval(interval), extension))
+	}
+	if err := feed.WriteFile(path, encoder, candles); err != nil {
+		return failure("fetch", err)
+	}
+	fmt.Fprintf(os.Stdout, "wrote %d candles to %s\n", len(candles), path)
+	return exitOK
+}
+
+// fetchMissing downloads the gaps of key between from and to into the store at path. A zero from starts
+// at the first stored candle, a zero to ends with the last closed candle, so the store never keeps a
+// candle that is still open
+func fetchMissing(ctx context.Context, client *exchange.BybitClient, path string, key store.Key, from, to time.Time) int {
+	s, err := store.Open(path)
+	if err != nil {
+		return failure("fetch", err)
+	}
+	defer s.Close()
+
+	if from.IsZero() {
+		first, _, count, err := s.Bounds(key)
+		if err != nil {
+			return failure("fetch", err)
+		}
+		if count == 0 {
+			return fail("fetch", exitUsage, fmt.Errorf("-from: a start is required, %s holds no candles of %v", path, key))
+		}
+		from = first
+	}
+	if to.IsZero() {
+		to = time.Now().Truncate(key.Interval)
+	}
+
+	gaps, err := s.Gaps(key, from, to)
+	if err != nil {
+		return failure("fetch", err)
+	}
+	stored := 0
+	for _, gap := range gaps {
+		candles, err := client.Candles(ctx, key.Symbol, key.Interval, gap.From, gap.To)
+		if err != nil {
+			return failure("fetch", fmt.Errorf("after storing %d candles: %w", stored, err))
+		}
+		if err := s.Upsert(key, candles); err != nil {
+			return failure("fetch", err)
+		}
+		stored += len(candles)
+	}
+	fmt.Fprintf(os.Stdout, "stored %d candles in %d gaps under %v\n", stored, len(gaps), key)
+	return exitOK
+}
+
+// encoderByName returns the encoder of the format and the extension of its files
+func encoderByName(name, symbol, category string) (feed.Encoder, string, error) {
+	switch name {
+	case "bybit":
+		return feed.BybitFormat{Symbol: symbol, Category: category}, ".json", nil
+	case "ndjson":
+		return feed.NDJSONFormat{}, ".ndjson", nil
+	case "csv":
+		return feed.DefaultCSVFormat(), ".csv", nil
+	default:
+		return nil, "", fmt.Errorf("unknown format %q", name)
+	}
+}
+
+// parseDate reads a day or an RFC 3339 time in UTC, an empty value is the zero time
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected 2006-01-02 or 2006-01-02T15:04:05Z", value)
+	}
+	return t, nil
+}
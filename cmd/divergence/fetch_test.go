@@ -0,0 +1,64 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/divergence/pkg/exchange/exchangetest"
+	"github.com/divergence/pkg/store"
+)
+
+func TestFetchStore(t *testing.T) {
+	candles := exchangetest.Candles(30, 4*time.Hour)
+	fake := exchangetest.NewBybit(candles)
+	defer fake.Close()
+
+	path := filepath.Join(t.TempDir(), "candles.db")
+	key := store.Key{Exchange: "bybit", Symbol: "BTCUSDT", Interval: 4 * time.Hour}
+	s, err := store.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Upsert(key, append(append(candles[:10:10], candles[15:20]...), candles[22])); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	to := exchangetest.Start.Add(30 * 4 * time.Hour).Format(time.RFC3339)
+	fetch := func(args ...string) int {
+		return runFetch(append([]string{"-symbol", "BTCUSDT", "-interval", "4h", "-store", path, "-url", fake.URL, "-to", to}, args...))
+	}
+
+	// without -from the fetch starts at the first stored candle and only asks for the 3 gaps
+	if code := fetch(); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+	if requests := fake.Requests(); requests != 3 {
+		t.Errorf("got %d requests, want one per gap", requests)
+	}
+
+	s, err = store.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, last, count, err := s.Bounds(key)
+	s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 30 || !first.Equal(candles[0].StartTime()) || !last.Equal(candles[29].StartTime()) {
+		t.Errorf("the store holds %d candles from %v to %v, want all 30", count, first, last)
+	}
+
+	if code := fetch(); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+	if requests := fake.Requests(); requests != 3 {
+		t.Errorf("a complete store made %d more requests", requests-3)
+	}
+
+	if code := runFetch([]string{"-symbol", "ETHUSDT", "-store", path, "-url", fake.URL}); code != exitUsage {
+		t.Errorf("a key without candles and no -from exited with %d, want %d", code, exitUsage)
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/divergence/pkg/backtest"
+	"github.com/divergence/pkg/feed"
+	"github.com/divergence/pkg/models"
+	"github.com/divergence/pkg/store"
+	"github.com/divergence/pkg/ta/divergence_detection"
+)
+
+// usageError marks errors in the flags of a command
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string { return e.err.Error() }
+func (e usageError) Unwrap() error { return e.err }
+
+// newFlagSet returns a flag set that reports errors instead of exiting
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	return flags
+}
+
+// parseFlags parses args and prints the usage of flags on errors and -h
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	err := flags.Parse(args)
+	if err == nil {
+		if flags.NArg() > 0 {
+			err = fmt.Errorf("unexpected argument %q", flags.Arg(0))
+		} else {
+			return nil
+		}
+	}
+
+	flags.SetOutput(nil)
+	if !errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintf(flags.Output(), "%s: %v\n", flags.Name(), err)
+	}
+	fmt.Fprintf(flags.Output(), "usage of %s:\n", flags.Name())
+	flags.PrintDefaults()
+	return usageError{err}
+}
+
+// exitCode returns exitOK for -h and exitUsage for other flag errors
+func exitCode(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	return exitUsage
+}
+
+// inputFlags select the candle file or the store key a command reads
+type inputFlags struct {
+	path         string
+	format       string
+	symbol       string
+	interval     string
+	openInterest string
+	store        string
+	exchange     string
+	from         string
+	to           string
+}
+
+func addInputFlags(flags *flag.FlagSet) *inputFlags {
+	f := &inputFlags{}
+	flags.StringVar(&f.path, "input", "data/btc-4h.json", "candle file")
+	flags.StringVar(&f.format, "format", "", "format of the candle file: bybit, binance, ndjson or csv. Guessed from the extension when empty")
+	flags.StringVar(&f.symbol, "symbol", "", "symbol of the candles, taken from the file name like btc-4h.json when empty")
+	flags.StringVar(&f.interval, "interval", "", "timeframe of the candles like 15m, 4h or 1d, inferred from the candles when empty")
+	flags.StringVar(&f.openInterest, "open-interest", "", "Bybit open interest response (.json) or time,value file (.csv) merged into the candles")
+	flags.StringVar(&f.store, "store", "", "store to read the candles of -exchange, -symbol and -interval from instead of -input")
+	flags.StringVar(&f.exchange, "exchange", "bybit", "exchange of the candles in -store")
+	flags.StringVar(&f.from, "from", "", "first day or time read from -store, like 2024-10-01. Empty reads from the first candle")
+	flags.StringVar(&f.to, "to", "", "day or time read from -store up to, excluded. Empty reads up to the last candle")
+	return f
+}
+
+func (f *inputFlags) source() (feed.FileSource, error) {
+	var format feed.Format
+	var err error
+	if f.format != "" {
+		format, err = feed.FormatByName(f.format)
+	} else {
+		format, err = feed.FormatOf(f.path)
+	}
+	if err != nil {
+		return feed.FileSource{}, usageError{err}
+	}
+
+	interval, err := f.parseInterval()
+	if err != nil {
+		return feed.FileSource{}, err
+	}
+	return feed.FileSource{Path: f.path, Format: format, Interval: interval}, nil
+}
+
+func (f *inputFlags) parseInterval() (time.Duration, error) {
+	if f.interval == "" {
+		return 0, nil
+	}
+	interval, err := models.ParseInterval(f.interval)
+	if err != nil {
+		return 0, usageError{err}
+	}
+	return interval, nil
+}
+
+// storeSource returns the candles of the store key selected by the flags. The store has to be closed
+// once the candles are read
+func (f *inputFlags) storeSource() (store.Source, error) {
+	if f.symbol == "" || f.interval == "" {
+		return store.Source{}, usageError{errors.New("-store needs -symbol and -interval")}
+	}
+	interval, err := f.parseInterval()
+	if err != nil {
+		return store.Source{}, err
+	}
+	from, err := parseDate(f.from)
+	if err != nil {
+		return store.Source{}, usageError{fmt.Errorf("-from: %w", err)}
+	}
+	to, err := parseDate(f.to)
+	if err != nil {
+		return store.Source{}, usageError{fmt.Errorf("-to: %w", err)}
+	}
+
+	s, err := store.Open(f.store)
+	if err != nil {
+		return store.Source{}, err
+	}
+	key := store.Key{Exchange: f.exchange, Symbol: f.symbol, Interval: interval}
+	return store.Source{Store: s, Key: key, From: from, To: to}, nil
+}
+
+// readCandles reads the candle file or the store without the open interest
+func (f *inputFlags) readCandles() ([]*models.Candle, error) {
+	if f.store == "" {
+		if f.from != "" || f.to != "" {
+			return nil, usageError{errors.New("-from and -to select candles of -store")}
+		}
+		source, err := f.source()
+		if err != nil {
+			return nil, err
+		}
+		return source.Candles()
+	}
+
+	source, err := f.storeSource()
+	if err != nil {
+		return nil, err
+	}
+	defer source.Store.Close()
+	candles, err := source.Candles()
+	if err == nil && len(candles) == 0 {
+		err = fmt.Errorf("%s holds no candles of %v", f.store, source.Key)
+	}
+	return candles, err
+}
+
+// candles reads the candle file or the store and merges the open interest into it
+func (f *inputFlags) candles() ([]*models.Candle, error) {
+	candles, err := f.readCandles()
+	if err != nil {
+		return nil, err
+	}
+
+	if f.openInterest != "" {
+		var format feed.PointFormat = feed.BybitOpenInterestFormat{}
+		if strings.EqualFold(filepath.Ext(f.openInterest), ".csv") {
+			format = feed.DefaultCSVPointFormat()
+		}
+		points, err := feed.PointFileSource{Path: f.openInterest, Format: format}.Points()
+		if err != nil {
+			return nil, err
+		}
+		models.MergeOpenInterest(candles, points)
+	}
+	return candles, nil
+}
+
+func (f *inputFlags) asset() (models.Asset, error) {
+	candles, err := f.candles()
+	if err != nil {
+		return models.Asset{}, err
+	}
+	return models.AssetFromCandles(candles), nil
+}
+
+// symbolName returns the symbol flag or the part of the file name before the interval
+func (f *inputFlags) symbolName() string {
+	if f.symbol != "" {
+		return f.symbol
+	}
+	name := strings.TrimSuffix(filepath.Base(f.path), filepath.Ext(f.path))
+	if dash := strings.LastIndex(name, "-"); dash > 0 {
+		name = name[:dash]
+	}
+	return strings.ToUpper(name)
+}
+
+// detectorFlags set up the detector
+type detectorFlags struct {
+	config     divergence_detection.DetectorConfig
+	oscillator string
+	period     int
+	priceMode  string
+}
+
+// addDetectorFlags adds the flags of the detector with config as defaults. -lookback sets the window of the
+// config, the number of newest candles that are scanned
+func addDetectorFlags(flags *flag.FlagSet, config divergence_detection.DetectorConfig) *detectorFlags {
+	f := &detectorFlags{config: config, oscillator: "rsi", period: 14, priceMode: config.PriceMode.String()}
+	flags.StringVar(&f.oscillator, "oscillator", f.oscillator, "oscillator: rsi, macd, stochastic, cci, mfi, obv, williamsr or oi")
+	flags.IntVar(&f.period, "period", f.period, "period of the oscillator")
+	flags.IntVar(&f.config.Order, "order", config.Order, "bars on each side a pivot has to exceed")
+	flags.IntVar(&f.config.ChainLength, "k", config.ChainLength, "number of consecutive higher or lower pivots that form a trend")
+	flags.IntVar(&f.config.AlignmentTolerance, "tolerance", config.AlignmentTolerance, "bars a price pivot and its indicator pivot may be apart")
+	flags.StringVar(&f.priceMode, "price", f.priceMode, "prices the pivots are taken from: close, wick or body")
+	flags.Float64Var(&f.config.MinScore, "min-score", config.MinScore, "drop divergences with a lower score, between 0 and 1")
+	flags.IntVar(&f.config.Window, "lookback", config.Window, "number of most recent candles that are scanned, 0 scans all")
+	return f
+}
+
+// detectorConfig applies the flags to the config
+func (f *detectorFlags) detectorConfig() (divergence_detection.DetectorConfig, error) {
+	config := f.config
+
+	oscillator, err := divergence_detection.OscillatorByName(f.oscillator, f.period)
+	if err != nil {
+		return config, usageError{err}
+	}
+	config.Oscillator = oscillator
+
+	modes := map[string]divergence_detection.PriceMode{
+		"close": divergence_detection.ClosePrice,
+		"wick":  divergence_detection.WickPrice,
+		"body":  divergence_detection.BodyPrice,
+	}
+	mode, ok := modes[f.priceMode]
+	if !ok {
+		return config, usageError{fmt.Errorf("unknown price mode %q", f.priceMode)}
+	}
+	config.PriceMode = mode
+
+	if config.Window < 0 {
+		return config, usageError{fmt.Errorf("lookback must be >= 0, got %d", config.Window)}
+	}
+	if config.Window > 0 && config.Window < config.MinCandles() {
+		return config, usageError{fmt.Errorf("lookback of %d candles is smaller than the %d candles needed", config.Window, config.MinCandles())}
+	}
+	if err := config.Validate(); err != nil {
+		return config, usageError{err}
+	}
+	return config, nil
+}
+
+// recent returns the candles of asset within -lookback, for the commands that test the candles they are
+// given as a whole
+func (f *detectorFlags) recent(asset models.Asset) models.Asset {
+	if window := f.config.Window; window > 0 && window < asset.Len() {
+		return asset.Slice(asset.Len()-window, asset.Len())
+	}
+	return asset
+}
+
+// simulatorFlags set up the trade simulator
+type simulatorFlags struct {
+	config backtest.SimulatorConfig
+	stop   string
+}
+
+// addSimulatorFlags adds the flags of the trade simulator with its defaults
+func addSimulatorFlags(flags *flag.FlagSet) *simulatorFlags {
+	f := &simulatorFlags{config: backtest.DefaultSimulatorConfig()}
+	f.stop = f.config.Stop.String()
+	flags.StringVar(&f.stop, "stop", f.stop, "stop of the simulated trades: pivot or atr")
+	flags.Float64Var(&f.config.StopBuffer, "stop-buffer", f.config.StopBuffer, "fraction of the pivot price the pivot stop is moved away")
+	flags.Float64Var(&f.config.ATRMultiple, "atr-multiple", f.config.ATRMultiple, "number of ATRs between entry and an atr stop")
+	flags.Float64Var(&f.config.TakeProfit, "take-profit", f.config.TakeProfit, "target in multiples of the risk, 0 trades without a target")
+	flags.IntVar(&f.config.MaxBars, "max-bars", f.config.MaxBars, "close trades after this many bars, 0 holds them")
+	flags.Float64Var(&f.config.MakerFee, "maker-fee", f.config.MakerFee, "fee of targets as a fraction of the traded value")
+	flags.Float64Var(&f.config.TakerFee, "taker-fee", f.config.TakerFee, "fee of entries and stops as a fraction of the traded value")
+	flags.Float64Var(&f.config.Slippage, "slippage", f.config.Slippage, "slippage of market orders as a fraction of the price")
+	flags.Float64Var(&f.config.InitialEquity, "equity", f.config.InitialEquity, "initial equity")
+	flags.Float64Var(&f.config.RiskPerTrade, "risk", f.config.RiskPerTrade, "fraction of the equity risked per trade")
+	flags.Float64Var(&f.config.MaxLeverage, "max-leverage", f.config.MaxLeverage, "cap of the position value in multiples of the equity, 0 is uncapped")
+	return f
+}
+
+// simulatorConfig applies the flags to the config
+func (f *simulatorFlags) simulatorConfig() (backtest.SimulatorConfig, error) {
+	config := f.config
+	switch f.stop {
+	case "pivot":
+		config.Stop = backtest.PivotStop
+	case "atr":
+		config.Stop = backtest.ATRStop
+	default:
+		return config, usageError{fmt.Errorf("unknown stop %q, expected pivot or atr", f.stop)}
+	}
+	return config, nil
+}
+
+// failure returns exitUsage for errors in the flags and exitFailure for others
+func failure(command string, err error) int {
+	if errors.As(err, &usageError{}) {
+		return fail(command, exitUsage, err)
+	}
+	return fail(command, exitFailure, err)
+}
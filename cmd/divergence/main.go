@@ -2,70 +2,77 @@ package main
 
 import (
 	"fmt"
-	"io"
 	"os"
-	"time"
-
-	"github.com/divergence/pkg/common"
-	"github.com/divergence/pkg/logger"
-	"github.com/divergence/pkg/models"
-	"github.com/divergence/pkg/ta/divergence_detection"
+	"sort"
 )
 
+// exit codes of the commands
+const (
+	exitOK = 0
+	// exitFailure is returned when a command could not finish, like on an unreadable file
+	exitFailure = 1
+	// exitUsage is returned on invalid flags or arguments
+	exitUsage = 2
+	// exitIssues is returned by validate when the candles have problems
+	exitIssues = 3
+)
 
-
-func main() {
-	logger.Info("Starting calculation of divergences on BTC/USDT!")
-
-	// load candles from data/btc-4h.json and convert them to the the candls object in models folder
-	candles := loadCandles("./data/btc-4h.json")
-
-	logger.Infof("Loaded %d candles", len(candles.Date))
-
-	// plot the chart for the closing prices of the candles
-	models.PlotCandlestickChart(candles.Closing, candles.Date, "BTC/USDT")
-
-	divergence_detection.CalcDivergence(candles.Closing, candles.Date )
+type command struct {
+	summary string
+	run     func(args []string) int
 }
 
-func loadCandles(location string) models.Asset {
-	jsonFile, err := os.Open(location)
+var commands = map[string]command{
+	"detect":      {"detect divergences in a candle file", runDetect},
+	"scan":        {"rank the current divergences of many candle files", runScan},
+	"plot":        {"plot the candles, pivots and trend lines of a candle file", runPlot},
+	"backtest":    {"measure how price moved after past divergences", runBacktest},
+	"sweep":       {"backtest a grid of detector settings and rank them", runSweep},
+	"walkforward": {"choose detector settings in sample and trade them out of sample", runWalkForward},
+	"fetch":       {"download candles from an exchange", runFetch},
+	"validate":    {"check a candle file for gaps and bad candles", runValidate},
+}
 
-	if err != nil {
-		fmt.Println(err)
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitUsage)
 	}
-	logger.Infof("Successfully Opened %s", location)
-	byteValue, _ := io.ReadAll(jsonFile)
-
-	defer jsonFile.Close()
 
-	var rawData struct {
-		List [][]string `json:"list"`
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		usage()
+		os.Exit(exitOK)
 	}
-	common.JSONDecode(byteValue, &rawData)
 
-	if err != nil {
-		logger.Errorf("Error decoding json: %v", err)
+	command, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage()
+		os.Exit(exitUsage)
 	}
+	os.Exit(command.run(os.Args[2:]))
+}
 
-	candles := []*models.Candle{}
-	for _, candle := range rawData.List {
-		candles = append(candles, &models.Candle{
-			Open:        common.StringToFloat64(candle[1]),
-			High:        common.StringToFloat64(candle[2]),
-			Low:         common.StringToFloat64(candle[3]),
-			Close:       common.StringToFloat64(candle[4]),
-			BaseVolume:  common.StringToFloat64(candle[5]),
-			QuoteVolume: common.StringToFloat64(candle[6]),
-			OpenTime:    candle[0],
-			CloseTime:   time.Unix(common.StringToInt64(candle[0])/1000, 0).Add(time.Minute * 60).Unix(),
-		})
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	candleList := models.Asset{}
-	for _, candle := range candles {
-		candleList.AddCandle(candle)
+	fmt.Fprintln(os.Stderr, "usage: divergence <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", name, commands[name].summary)
 	}
-	
-	return candleList
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "run divergence <command> -h for the flags of a command")
+}
+
+// fail prints err for command and returns code
+func fail(command string, code int, err error) int {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", command, err)
+	return code
 }
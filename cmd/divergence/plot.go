@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/divergence/pkg/logger"
+	"github.com/divergence/pkg/models"
+	"github.com/divergence/pkg/ta/divergence_detection"
+)
+
+// runPlot draws the charts of the README for a candle file
+func runPlot(args []string) int {
+	flags := newFlagSet("plot")
+	input := addInputFlags(flags)
+	detector := addDetectorFlags(flags, divergence_detection.DefaultDetectorConfig())
+	dir := flags.String("out-dir", ".", "directory the charts are written to")
+	if err := parseFlags(flags, args); err != nil {
+		return exitCode(err)
+	}
+
+	config, err := detector.detectorConfig()
+	if err != nil {
+		return failure("plot", err)
+	}
+	asset, err := input.asset()
+	if err != nil {
+		return failure("plot", err)
+	}
+	asset = detector.recent(asset)
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		return failure("plot", err)
+	}
+
+	logger.SetDebug(false)
+	models.SaveCandlestickChart(asset.Closing, asset.Date, input.symbolName(), filepath.Join(*dir, "chart.png"))
+	paths, err := divergence_detection.PlotDivergences(asset, config, *dir)
+	if err != nil {
+		return failure("plot", err)
+	}
+	for _, path := range paths {
+		fmt.Fprintf(os.Stdout, "Plot saved as %s\n", path)
+	}
+	return exitOK
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/divergence/pkg/logger"
+	"github.com/divergence/pkg/scan"
+	"github.com/divergence/pkg/store"
+)
+
+// runScan ranks the current divergences of the symbols in a config file, a directory of candle files or a store
+func runScan(args []string) int {
+	options := scan.DefaultOptions()
+
+	flags := newFlagSet("scan")
+	config := flags.String("config", "", "JSON file listing the symbols, intervals and candle files")
+	dir := flags.String("dir", "", "directory of candle files named <symbol>-<interval>.<ext>")
+	format := flags.String("format", "", "format of the candle files, guessed from the extension when empty")
+	storePath := flags.String("store", "", "store whose keys are scanned")
+	exchange := flags.String("exchange", "", "only scan the keys of this exchange in -store")
+	detector := addDetectorFlags(flags, options.Detector)
+	flags.IntVar(&options.Workers, "workers", 0, "number of files scanned at the same time, 0 uses one per CPU")
+	flags.IntVar(&options.MaxAge, "max-age", options.MaxAge, "bars since confirmation up to which a divergence is current")
+	flags.BoolVar(&options.Confluence, "confluence", false, "only report divergences that agree with one on a higher interval of the symbol, -lookback counts candles of the highest interval")
+	if err := parseFlags(flags, args); err != nil {
+		return exitCode(err)
+	}
+	sources := 0
+	for _, source := range []string{*config, *dir, *storePath} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fail("scan", exitUsage, errors.New("set one of -config, -dir or -store"))
+	}
+
+	var err error
+	if options.Detector, err = detector.detectorConfig(); err != nil {
+		return failure("scan", err)
+	}
+
+	var jobs []scan.Job
+	switch {
+	case *config != "":
+		jobs, err = scan.LoadConfig(*config)
+	case *dir != "":
+		jobs, err = scan.JobsFromDir(*dir, *format)
+	default:
+		var s *store.Store
+		if s, err = store.Open(*storePath); err != nil {
+			return failure("scan", err)
+		}
+		defer s.Close()
+		jobs, err = scan.JobsFromStore(s, *exchange)
+	}
+	if err != nil {
+		return failure("scan", err)
+	}
+
+	logger.SetDebug(false)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	results, scanErr := scan.Scan(ctx, jobs, options)
+	if err := scan.WriteTable(os.Stdout, results); err != nil {
+		return failure("scan", err)
+	}
+	if scanErr != nil {
+		return fail("scan", exitFailure, fmt.Errorf("some files failed:\n%w", scanErr))
+	}
+	return exitOK
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/divergence/pkg/backtest"
+	"github.com/divergence/pkg/logger"
+)
+
+// runSweep backtests a grid of detector settings on a candle file and ranks them
+func runSweep(args []string) int {
+	flags := newFlagSet("sweep")
+	input := addInputFlags(flags)
+	detector := addDetectorFlags(flags, backtest.DefaultOptions().Detector)
+	simulator := addSimulatorFlags(flags)
+	sweep := addSweepFlags(flags)
+	top := flags.Int("top", 20, "number of results shown, 0 shows all")
+	outputFlag := flags.String("output", "text", "output format: text or json")
+	if err := parseFlags(flags, args); err != nil {
+		return exitCode(err)
+	}
+	if *outputFlag != "text" && *outputFlag != "json" {
+		return fail("sweep", exitUsage, fmt.Errorf("unknown output format %q, expected text or json", *outputFlag))
+	}
+	options, params, err := sweep.options(detector, simulator)
+	if err != nil {
+		return failure("sweep", err)
+	}
+
+	asset, err := input.asset()
+	if err != nil {
+		return failure("sweep", err)
+	}
+
+	logger.SetDebug(false)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	results, sweepErr := backtest.Sweep(ctx, input.symbolName(), detector.recent(asset), params, options)
+	backtest.RankSweep(results, sweep.metric)
+	if *top > 0 && len(results) > *top {
+		results = results[:*top]
+	}
+
+	if *outputFlag == "text" {
+		err = backtest.WriteSweep(os.Stdout, results, sweep.metric)
+	} else {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(map[string]interface{}{"metric": sweep.metric, "combinations": len(params), "results": results})
+	}
+	if err != nil {
+		return failure("sweep", err)
+	}
+	if sweepErr != nil {
+		return fail("sweep", exitFailure, fmt.Errorf("some combinations failed:\n%w", sweepErr))
+	}
+	return exitOK
+}
+
+// sweepFlags set up the params a sweep tries
+type sweepFlags struct {
+	orders       string
+	chainLengths string
+	periods      string
+	tolerances   string
+	rolling      string
+	random       int
+	seed         int64
+	workers      int
+	metric       string
+}
+
+// addSweepFlags adds the flags of the params grid, the search and the ranking metric
+func addSweepFlags(flags *flag.FlagSet) *sweepFlags {
+	f := &sweepFlags{}
+	flags.StringVar(&f.orders, "orders", "", "orders to try, like 2,3,4 or 2-6. Empty keeps -order")
+	flags.StringVar(&f.chainLengths, "ks", "", "chain lengths to try. Empty keeps -k")
+	flags.StringVar(&f.periods, "periods", "", "oscillator periods to try. Empty keeps -period")
+	flags.StringVar(&f.tolerances, "tolerances", "", "alignment tolerances to try. Empty keeps -tolerance")
+	flags.StringVar(&f.rolling, "rolling", "0", "rolling detection windows to try, 0 runs the detector once")
+	flags.IntVar(&f.random, "random", 0, "try this many combinations picked at random instead of the whole grid")
+	flags.Int64Var(&f.seed, "seed", 1, "seed of the random search")
+	flags.IntVar(&f.workers, "workers", 0, "number of combinations run at the same time, 0 uses one per CPU")
+	flags.StringVar(&f.metric, "metric", "sharpe", "metric the results are ranked by: "+strings.Join(backtest.Metrics(), ", "))
+	return f
+}
+
+// options returns the sweep options and the params to try, the detector flags are the base of the grid
+func (f *sweepFlags) options(detector *detectorFlags, simulator *simulatorFlags) (backtest.SweepOptions, []backtest.Params, error) {
+	if _, err := backtest.Metric(backtest.Report{}, f.metric); err != nil {
+		return backtest.SweepOptions{}, nil, usageError{err}
+	}
+
+	var grid backtest.Grid
+	lists := []struct {
+		name   string
+		value  string
+		values *[]int
+	}{
+		{"orders", f.orders, &grid.Order},
+		{"ks", f.chainLengths, &grid.ChainLength},
+		{"periods", f.periods, &grid.Period},
+		{"tolerances", f.tolerances, &grid.AlignmentTolerance},
+		{"rolling", f.rolling, &grid.Lookback},
+	}
+	for _, list := range lists {
+		if list.value == "" {
+			continue
+		}
+		values, err := parseInts(list.value)
+		if err != nil {
+			return backtest.SweepOptions{}, nil, usageError{fmt.Errorf("-%s: %w", list.name, err)}
+		}
+		*list.values = values
+	}
+
+	config, err := detector.detectorConfig()
+	if err != nil {
+		return backtest.SweepOptions{}, nil, err
+	}
+	simulatorConfig, err := simulator.simulatorConfig()
+	if err != nil {
+		return backtest.SweepOptions{}, nil, err
+	}
+	options := backtest.SweepOptions{Detector: config, Oscillator: detector.oscillator, Simulator: simulatorConfig, Workers: f.workers}
+
+	base := backtest.Params{
+		Order:              config.Order,
+		ChainLength:        config.ChainLength,
+		Period:             detector.period,
+		AlignmentTolerance: config.AlignmentTolerance,
+	}
+	if f.random > 0 {
+		return options, grid.Sample(base, f.random, rand.New(rand.NewSource(f.seed))), nil
+	}
+	return options, grid.Params(base), nil
+}
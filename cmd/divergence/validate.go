@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/divergence/pkg/feed"
+	"github.com/divergence/pkg/models"
+)
+
+// runValidate reports the problems of a candle file or a store key and optionally writes a repaired copy
+func runValidate(args []string) int {
+	flags := newFlagSet("validate")
+	input := addInputFlags(flags)
+	repair := flags.String("repair", "", "write a repaired copy with strategy drop, ffill or interpolate")
+	out := flags.String("out", "", "file the repaired candles are written to, in the format of the input")
+	if err := parseFlags(flags, args); err != nil {
+		return exitCode(err)
+	}
+
+	strategies := map[string]models.RepairStrategy{
+		"drop":        models.DropBars,
+		"ffill":       models.ForwardFill,
+		"interpolate": models.Interpolate,
+	}
+	strategy, ok := strategies[*repair]
+	if *repair != "" && !ok {
+		return fail("validate", exitUsage, fmt.Errorf("unknown repair strategy %q", *repair))
+	}
+	if (*repair == "") != (*out == "") {
+		return fail("validate", exitUsage, fmt.Errorf("-repair and -out are used together"))
+	}
+
+	if *repair != "" && input.store != "" {
+		return fail("validate", exitUsage, fmt.Errorf("-repair writes a copy of a candle file, it cannot be used with -store"))
+	}
+	candles, err := input.readCandles()
+	if err != nil {
+		return failure("validate", err)
+	}
+	interval, err := input.parseInterval()
+	if err != nil {
+		return failure("validate", err)
+	}
+
+	report := models.Validate(candles, interval)
+	for _, issue := range report.Issues {
+		fmt.Fprintln(os.Stdout, issue)
+	}
+	filled := report.Count(models.Filled)
+	fmt.Fprintf(os.Stdout, "%d candles of %s, %d issues, %d filled\n", len(candles), models.FormatInterval(report.Interval), len(report.Issues)-filled, filled)
+
+	if *repair == "" {
+		if !report.OK() {
+			return exitIssues
+		}
+		return exitOK
+	}
+
+	source, err := input.source()
+	if err != nil {
+		return failure("validate", err)
+	}
+	encoder, ok := source.Format.(feed.Encoder)
+	if !ok {
+		return fail("validate", exitUsage, fmt.Errorf("cannot write the format of %s", input.path))
+	}
+	repaired, err := models.Repair(candles, strategy, interval)
+	if err != nil {
+		return failure("validate", err)
+	}
+	if err := feed.WriteFile(*out, encoder, repaired); err != nil {
+		return failure("validate", err)
+	}
+	fmt.Fprintf(os.Stdout, "wrote %d candles to %s\n", len(repaired), *out)
+	return exitOK
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/divergence/pkg/backtest"
+	"github.com/divergence/pkg/logger"
+)
+
+// runWalkForward chooses detector settings on rolling in-sample windows and trades them on the windows after
+func runWalkForward(args []string) int {
+	flags := newFlagSet("walkforward")
+	input := addInputFlags(flags)
+	detector := addDetectorFlags(flags, backtest.DefaultOptions().Detector)
+	simulator := addSimulatorFlags(flags)
+	sweep := addSweepFlags(flags)
+	inSample := flags.Int("in-sample", 200, "bars the settings are chosen on")
+	outOfSample := flags.Int("out-of-sample", 50, "bars the chosen settings are traded on before choosing again")
+	anchored := flags.Bool("anchored", false, "start every in-sample window at the first bar instead of rolling it")
+	outputFlag := flags.String("output", "text", "output format: text or json")
+	tradesPath := flags.String("trades", "", "CSV file the out-of-sample trade log is written to")
+	equityPath := flags.String("equity-curve", "", "CSV file the stitched out-of-sample equity curve is written to")
+	if err := parseFlags(flags, args); err != nil {
+		return exitCode(err)
+	}
+	if *outputFlag != "text" && *outputFlag != "json" {
+		return fail("walkforward", exitUsage, fmt.Errorf("unknown output format %q, expected text or json", *outputFlag))
+	}
+	options, params, err := sweep.options(detector, simulator)
+	if err != nil {
+		return failure("walkforward", err)
+	}
+
+	asset, err := input.asset()
+	if err != nil {
+		return failure("walkforward", err)
+	}
+
+	logger.SetDebug(false)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	result, walkErr := backtest.WalkForward(ctx, input.symbolName(), detector.recent(asset), backtest.WalkForwardOptions{
+		Sweep:       options,
+		Candidates:  params,
+		Metric:      sweep.metric,
+		InSample:    *inSample,
+		OutOfSample: *outOfSample,
+		Anchored:    *anchored,
+	})
+	if len(result.Windows) == 0 {
+		return failure("walkforward", walkErr)
+	}
+
+	if err := writeCSV(*tradesPath, func(w io.Writer) error { return backtest.WriteTrades(w, result.Simulation.Trades) }); err != nil {
+		return failure("walkforward", err)
+	}
+	if err := writeCSV(*equityPath, func(w io.Writer) error { return backtest.WriteEquity(w, result.Simulation.Equity) }); err != nil {
+		return failure("walkforward", err)
+	}
+
+	if *outputFlag == "text" {
+		err = backtest.WriteWalkForward(os.Stdout, result, sweep.metric)
+	} else {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(map[string]interface{}{"metric": sweep.metric, "combinations": len(params), "walkForward": result})
+	}
+	if err != nil {
+		return failure("walkforward", err)
+	}
+	if walkErr != nil {
+		return fail("walkforward", exitFailure, walkErr)
+	}
+	return exitOK
+}
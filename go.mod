@@ -2,6 +2,14 @@ module github.com/divergence
 
 go 1.23.4
 
+require (
+	github.com/markcheno/go-talib v0.0.0-20190307022042-cd53a9264d70
+	github.com/sirupsen/logrus v1.9.3
+	github.com/wcharczuk/go-chart v2.0.1+incompatible
+	go.etcd.io/bbolt v1.3.11
+	gonum.org/v1/plot v0.15.0
+)
+
 require (
 	git.sr.ht/~sbinet/gg v0.6.0 // indirect
 	github.com/ajstarks/svgo v0.0.0-20211024235047-1546f124cd8b // indirect
@@ -10,12 +18,8 @@ require (
 	github.com/go-latex/latex v0.0.0-20240709081214-31cef3c7570e // indirect
 	github.com/go-pdf/fpdf v0.9.0 // indirect
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
-	github.com/markcheno/go-talib v0.0.0-20190307022042-cd53a9264d70 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/sirupsen/logrus v1.9.3 // indirect
-	github.com/wcharczuk/go-chart v2.0.1+incompatible // indirect
 	golang.org/x/image v0.23.0 // indirect
 	golang.org/x/sys v0.26.0 // indirect
 	golang.org/x/text v0.21.0 // indirect
-	gonum.org/v1/plot v0.15.0 // indirect
 )
@@ -0,0 +1,255 @@
+package backtest
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/divergence/pkg/models"
+	"github.com/divergence/pkg/ta/divergence_detection"
+)
+
+// Options holds the settings of a backtest
+type Options struct {
+	// Detector finds the divergences. Its Window is ignored, the whole asset is tested
+	Detector divergence_detection.DetectorConfig
+	// Horizons are the numbers of bars after the confirmation at which the return is measured
+	Horizons []int
+	// Lookback re-runs the detector on every bar over the last Lookback bars only, like a live scanner
+	// would. 0 runs it once over all bars
+	Lookback int
+}
+
+// DefaultOptions measures the returns after 1, 3, 6, 12 and 24 bars
+func DefaultOptions() Options {
+	detector := divergence_detection.DefaultDetectorConfig()
+	detector.Window = 0
+	return Options{Detector: detector, Horizons: []int{1, 3, 6, 12, 24}}
+}
+
+// Event is a divergence and how price moved after it was confirmed
+type Event struct {
+	Divergence divergence_detection.Divergence
+	// Entry is the close of the confirmation bar, the first price the divergence could be traded at
+	Entry float64
+	// Returns holds the return at every horizon in the direction of the divergence, so a falling price after
+	// a bearish divergence is positive. Horizons beyond the last bar are missing from the end
+	Returns []float64
+	// MFE and MAE are the largest favorable and adverse moves from the entry within the longest horizon,
+	// as positive fractions of the entry
+	MFE float64
+	MAE float64
+}
+
+// HorizonStats sums up the returns at one horizon
+type HorizonStats struct {
+	Bars    int     `json:"bars"`
+	Count   int     `json:"count"`
+	Mean    float64 `json:"mean"`
+	Median  float64 `json:"median"`
+	HitRate float64 `json:"hitRate"`
+}
+
+// Stats sums up the events of one divergence type, or of all types
+type Stats struct {
+	Type     string         `json:"type"`
+	Count    int            `json:"count"`
+	Horizons []HorizonStats `json:"horizons"`
+	MeanMFE  float64        `json:"meanMFE"`
+	MeanMAE  float64        `json:"meanMAE"`
+}
+
+// Result holds every event and the stats per divergence type, the stats of all events come first
+type Result struct {
+	Horizons []int
+	Events   []Event
+	Stats    []Stats
+}
+
+// Run backtests the divergences of asset. A divergence only counts from its confirmation bar, order bars
+// after its last pivot, and everything the detector uses up to that bar lies before it. Running it once
+// over all bars therefore finds the same divergences as running it on every bar with the bars known then
+func Run(asset models.Asset, options Options) (Result, error) {
+	horizons := append([]int(nil), options.Horizons...)
+	sort.Ints(horizons)
+	if len(horizons) == 0 || horizons[0] < 1 {
+		return Result{}, fmt.Errorf("horizons must be >= 1, got %v", options.Horizons)
+	}
+	if options.Lookback < 0 {
+		return Result{}, fmt.Errorf("lookback must be >= 0, got %d", options.Lookback)
+	}
+
+	config := options.Detector
+	config.Window = 0
+	detector, err := divergence_detection.NewDetector(config)
+	if err != nil {
+		return Result{}, err
+	}
+
+	divergences, err := detect(detector, asset, options.Lookback)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{Horizons: horizons, Events: []Event{}}
+	for _, divergence := range divergences {
+		result.Events = append(result.Events, newEvent(asset, divergence, horizons))
+	}
+	result.Stats = summarize(result.Events, horizons)
+	return result, nil
+}
+
+// detect returns the divergences in the order they are confirmed
+func detect(detector *divergence_detection.Detector, asset models.Asset, lookback int) ([]divergence_detection.Divergence, error) {
+	if lookback == 0 {
+		return detector.DetectAsset(asset)
+	}
+
+	minCandles := detector.Config().MinCandles()
+	if lookback < minCandles {
+		return nil, fmt.Errorf("lookback of %d bars is smaller than the %d bars the detector needs", lookback, minCandles)
+	}
+
+	divergences := []divergence_detection.Divergence{}
+	for end := lookback; end <= asset.Len(); end++ {
+		window, err := detector.DetectAsset(asset.Slice(end-lookback, end))
+		if err != nil {
+			return nil, err
+		}
+		// only the divergences confirmed on the last bar are new
+		for _, divergence := range window {
+			if divergence.ConfirmationIndex == lookback-1 {
+				divergence.Shift(end - lookback)
+				divergences = append(divergences, divergence)
+			}
+		}
+	}
+	return divergences, nil
+}
+
+func newEvent(asset models.Asset, d divergence_detection.Divergence, horizons []int) Event {
+	confirmation := d.ConfirmationIndex
+	event := Event{Divergence: d, Entry: asset.Closing[confirmation], Returns: []float64{}}
+
+	sign := 1.0
+	if d.Direction == divergence_detection.Bearish {
+		sign = -1
+	}
+	for _, bars := range horizons {
+		if confirmation+bars >= asset.Len() {
+			break
+		}
+		event.Returns = append(event.Returns, sign*(asset.Closing[confirmation+bars]/event.Entry-1))
+	}
+
+	// highs and lows are only there when the asset was built from candles
+	highs, lows := asset.High, asset.Low
+	if len(highs) != asset.Len() || len(lows) != asset.Len() {
+		highs, lows = asset.Closing, asset.Closing
+	}
+	last := min(confirmation+horizons[len(horizons)-1], asset.Len()-1)
+	for i := confirmation + 1; i <= last; i++ {
+		up := highs[i]/event.Entry - 1
+		down := 1 - lows[i]/event.Entry
+		if d.Direction == divergence_detection.Bearish {
+			up, down = down, up
+		}
+		event.MFE = math.Max(event.MFE, up)
+		event.MAE = math.Max(event.MAE, down)
+	}
+	return event
+}
+
+// summarize returns the stats of all events and then those of every type in alphabetical order
+func summarize(events []Event, horizons []int) []Stats {
+	byType := make(map[string][]Event)
+	types := []string{}
+	for _, event := range events {
+		t := event.Divergence.Type()
+		if _, ok := byType[t]; !ok {
+			types = append(types, t)
+		}
+		byType[t] = append(byType[t], event)
+	}
+	sort.Strings(types)
+
+	stats := []Stats{statsOf("all", events, horizons)}
+	for _, t := range types {
+		stats = append(stats, statsOf(t, byType[t], horizons))
+	}
+	return stats
+}
+
+func statsOf(t string, events []Event, horizons []int) Stats {
+	stats := Stats{Type: t, Count: len(events)}
+
+	for h, bars := range horizons {
+		returns := []float64{}
+		hits := 0
+		for _, event := range events {
+			if h < len(event.Returns) {
+				returns = append(returns, event.Returns[h])
+				if event.Returns[h] > 0 {
+					hits++
+				}
+			}
+		}
+
+		horizon := HorizonStats{Bars: bars, Count: len(returns)}
+		if len(returns) > 0 {
+			horizon.Mean = mean(returns)
+			horizon.Median = median(returns)
+			horizon.HitRate = float64(hits) / float64(len(returns))
+		}
+		stats.Horizons = append(stats.Horizons, horizon)
+	}
+
+	if len(events) > 0 {
+		for _, event := range events {
+			stats.MeanMFE += event.MFE
+			stats.MeanMAE += event.MAE
+		}
+		stats.MeanMFE /= float64(len(events))
+		stats.MeanMAE /= float64(len(events))
+	}
+	return stats
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values))
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// WriteTable writes the stats as an aligned table with the mean return and the hit rate of every horizon
+func WriteTable(w io.Writer, result Result) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(table, "TYPE\tCOUNT\t")
+	for _, bars := range result.Horizons {
+		fmt.Fprintf(table, "MEAN %d\tHIT %d\t", bars, bars)
+	}
+	fmt.Fprintln(table, "MFE\tMAE\t")
+
+	for _, stats := range result.Stats {
+		fmt.Fprintf(table, "%s\t%d\t", stats.Type, stats.Count)
+		for _, horizon := range stats.Horizons {
+			fmt.Fprintf(table, "%.2f%%\t%.0f%%\t", 100*horizon.Mean, 100*horizon.HitRate)
+		}
+		fmt.Fprintf(table, "%.2f%%\t%.2f%%\t\n", 100*stats.MeanMFE, 100*stats.MeanMAE)
+	}
+	return table.Flush()
+}
@@ -0,0 +1,124 @@
+package backtest
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/divergence/pkg/feed"
+	"github.com/divergence/pkg/logger"
+	"github.com/divergence/pkg/models"
+	"github.com/divergence/pkg/ta/divergence_detection"
+)
+
+func TestMain(m *testing.M) {
+	logger.SetDebug(false)
+	os.Exit(m.Run())
+}
+
+func loadAsset(t *testing.T) models.Asset {
+	t.Helper()
+	candles, err := feed.FileSource{Path: "../../data/btc-4h.json", Format: feed.BybitFormat{}}.Candles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return models.AssetFromCandles(candles)
+}
+
+func newTestDetector(t *testing.T, k int) *divergence_detection.Detector {
+	t.Helper()
+	config := DefaultOptions().Detector
+	config.ChainLength = k
+	detector, err := divergence_detection.NewDetector(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return detector
+}
+
+func TestDetectOnceMatchesEveryBar(t *testing.T) {
+	asset := loadAsset(t)
+
+	for _, k := range []int{2, 3} {
+		t.Run(fmt.Sprintf("k=%d", k), func(t *testing.T) {
+			detector := newTestDetector(t, k)
+			once, err := detect(detector, asset, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(once) == 0 {
+				t.Fatal("no divergences found")
+			}
+			sort.SliceStable(once, func(i, j int) bool { return once[i].ConfirmationIndex < once[j].ConfirmationIndex })
+
+			// run the detector on every bar with the bars known then
+			everyBar := []divergence_detection.Divergence{}
+			for end := detector.Config().MinCandles(); end <= asset.Len(); end++ {
+				found, err := detector.DetectAsset(asset.Slice(0, end))
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, d := range found {
+					if d.ConfirmationIndex == end-1 {
+						everyBar = append(everyBar, d)
+					}
+				}
+			}
+
+			if !reflect.DeepEqual(once, everyBar) {
+				t.Errorf("a single run found %d divergences, the run on every bar %d", len(once), len(everyBar))
+			}
+		})
+	}
+}
+
+func TestDetectOnceMatchesLookback(t *testing.T) {
+	asset := loadAsset(t)
+
+	// the oscillator values depend on where the window starts, so only the pivots are compared
+	type key struct {
+		confirmation, first, second int
+		kind                        string
+	}
+	keyOf := func(d divergence_detection.Divergence) key {
+		return key{d.ConfirmationIndex, d.PricePivots[0].Index, d.PricePivots[1].Index, d.Type()}
+	}
+
+	for _, k := range []int{2, 3} {
+		for _, lookback := range []int{100, 200} {
+			t.Run(fmt.Sprintf("k=%d/lookback=%d", k, lookback), func(t *testing.T) {
+				detector := newTestDetector(t, k)
+				once, err := detect(detector, asset, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				rolling, err := detect(detector, asset, lookback)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := []key{}
+				for _, d := range once {
+					// the rolling detector only starts on the last bar of its first window
+					if d.ConfirmationIndex >= lookback-1 {
+						want = append(want, keyOf(d))
+					}
+				}
+				sort.Slice(want, func(i, j int) bool { return want[i].confirmation < want[j].confirmation })
+				got := []key{}
+				for _, d := range rolling {
+					got = append(got, keyOf(d))
+				}
+
+				if len(want) == 0 {
+					t.Fatal("no divergences found")
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("lookback found %v, a single run %v", got, want)
+				}
+			})
+		}
+	}
+}
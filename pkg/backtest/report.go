@@ -0,0 +1,257 @@
+package backtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// year is the length of a year of a market that trades every day
+const year = 365 * 24 * time.Hour
+
+// TradeStats sums up a group of trades
+type TradeStats struct {
+	Name    string  `json:"name"`
+	Trades  int     `json:"trades"`
+	Wins    int     `json:"wins"`
+	Losses  int     `json:"losses"`
+	WinRate float64 `json:"winRate"`
+	PnL     float64 `json:"pnl"`
+	Fees    float64 `json:"fees"`
+	// ProfitFactor is the gross profit over the gross loss. It is +Inf when there are profits but no losses,
+	// which is written as null in JSON, and 0 without any profit
+	ProfitFactor float64 `json:"profitFactor"`
+	// Expectancy is the mean PnL of a trade
+	Expectancy float64 `json:"expectancy"`
+	AverageR   float64 `json:"averageR"`
+	// MaxWinStreak and MaxLossStreak are the longest runs of winning and losing trades
+	MaxWinStreak  int `json:"maxWinStreak"`
+	MaxLossStreak int `json:"maxLossStreak"`
+}
+
+// MarshalJSON writes an infinite profit factor as null, JSON has no infinity
+func (s TradeStats) MarshalJSON() ([]byte, error) {
+	type plain TradeStats
+	stats := struct {
+		plain
+		ProfitFactor *float64 `json:"profitFactor"`
+	}{plain: plain(s)}
+	if !math.IsInf(s.ProfitFactor, 0) {
+		stats.ProfitFactor = &s.ProfitFactor
+	}
+	return json.Marshal(stats)
+}
+
+// Report holds the performance metrics of a simulation. Returns are fractions, the annualized ones
+// assume a market that trades around the clock
+type Report struct {
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+	InitialEquity float64   `json:"initialEquity"`
+	FinalEquity   float64   `json:"finalEquity"`
+	TotalReturn   float64   `json:"totalReturn"`
+	CAGR          float64   `json:"cagr"`
+	// Sharpe and Sortino are annualized from the returns of every bar, without a risk free rate
+	Sharpe  float64 `json:"sharpe"`
+	Sortino float64 `json:"sortino"`
+	// MaxDrawdown is the largest fall from a peak of the equity
+	MaxDrawdown float64 `json:"maxDrawdown"`
+	// MaxDrawdownBars and MaxDrawdownDays are the longest time the equity stayed below a peak
+	MaxDrawdownBars int     `json:"maxDrawdownBars"`
+	MaxDrawdownDays float64 `json:"maxDrawdownDays"`
+	// Total sums up all trades, ByType and BySymbol split them up in alphabetical order
+	Total    TradeStats   `json:"total"`
+	ByType   []TradeStats `json:"byType"`
+	BySymbol []TradeStats `json:"bySymbol"`
+}
+
+// NewReport computes the metrics of simulation
+func NewReport(simulation Simulation) Report {
+	report := Report{
+		InitialEquity: simulation.InitialEquity,
+		FinalEquity:   simulation.InitialEquity,
+		Total:         tradeStats("all", simulation.Trades),
+		ByType:        groupTrades(simulation.Trades, func(t Trade) string { return t.Divergence.Type() }),
+		BySymbol:      groupTrades(simulation.Trades, func(t Trade) string { return t.Symbol }),
+	}
+
+	equity := simulation.Equity
+	if len(equity) == 0 {
+		return report
+	}
+	report.Start = equity[0].Time
+	report.End = equity[len(equity)-1].Time
+	report.FinalEquity = equity[len(equity)-1].Equity
+	report.TotalReturn = change(report.FinalEquity, report.InitialEquity)
+
+	interval := simulation.Interval
+	if interval <= 0 && len(equity) > 1 {
+		interval = equity[1].Time.Sub(equity[0].Time)
+	}
+	if years := float64(report.End.Sub(report.Start)+interval) / float64(year); years > 0 && report.FinalEquity > 0 {
+		report.CAGR = math.Pow(report.FinalEquity/report.InitialEquity, 1/years) - 1
+	}
+
+	// the first bar is measured against the initial equity, so a trade closed on it is not lost
+	returns := make([]float64, len(equity))
+	previous := report.InitialEquity
+	for i, point := range equity {
+		returns[i] = change(point.Equity, previous)
+		previous = point.Equity
+	}
+	if interval > 0 {
+		perYear := float64(year) / float64(interval)
+		report.Sharpe = ratio(mean(returns), stdDev(returns)) * math.Sqrt(perYear)
+		report.Sortino = ratio(mean(returns), downsideDev(returns)) * math.Sqrt(perYear)
+	}
+
+	peak, peakIndex := report.InitialEquity, -1
+	for i, point := range equity {
+		if point.Equity >= peak {
+			peak, peakIndex = point.Equity, i
+			continue
+		}
+		report.MaxDrawdown = math.Max(report.MaxDrawdown, -change(point.Equity, peak))
+		if bars := i - peakIndex; bars > report.MaxDrawdownBars {
+			report.MaxDrawdownBars = bars
+			from := report.Start.Add(-interval)
+			if peakIndex >= 0 {
+				from = equity[peakIndex].Time
+			}
+			report.MaxDrawdownDays = point.Time.Sub(from).Hours() / 24
+		}
+	}
+
+	return report
+}
+
+// groupTrades returns the stats of the trades of every key in alphabetical order
+func groupTrades(trades []Trade, key func(Trade) string) []TradeStats {
+	groups := make(map[string][]Trade)
+	keys := []string{}
+	for _, trade := range trades {
+		k := key(trade)
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], trade)
+	}
+	sort.Strings(keys)
+
+	stats := make([]TradeStats, len(keys))
+	for i, k := range keys {
+		stats[i] = tradeStats(k, groups[k])
+	}
+	return stats
+}
+
+// tradeStats sums up trades in the order they were closed
+func tradeStats(name string, trades []Trade) TradeStats {
+	stats := TradeStats{Name: name, Trades: len(trades)}
+	if len(trades) == 0 {
+		return stats
+	}
+
+	profit, loss, r := 0.0, 0.0, 0.0
+	wins, losses := 0, 0
+	for _, trade := range trades {
+		stats.PnL += trade.PnL
+		stats.Fees += trade.Fees
+		r += trade.R
+
+		switch {
+		case trade.PnL > 0:
+			stats.Wins++
+			profit += trade.PnL
+			wins, losses = wins+1, 0
+		case trade.PnL < 0:
+			stats.Losses++
+			loss -= trade.PnL
+			wins, losses = 0, losses+1
+		default:
+			wins, losses = 0, 0
+		}
+		stats.MaxWinStreak = max(stats.MaxWinStreak, wins)
+		stats.MaxLossStreak = max(stats.MaxLossStreak, losses)
+	}
+
+	stats.WinRate = float64(stats.Wins) / float64(len(trades))
+	stats.ProfitFactor = ratio(profit, loss)
+	if loss == 0 && profit > 0 {
+		stats.ProfitFactor = math.Inf(1)
+	}
+	stats.Expectancy = stats.PnL / float64(len(trades))
+	stats.AverageR = r / float64(len(trades))
+	return stats
+}
+
+// change is the move from previous to current, like ta.CalcChange but as a fraction instead of a percentage
+func change(current, previous float64) float64 {
+	if previous == 0 {
+		return 0
+	}
+	return current/previous - 1
+}
+
+func ratio(a, b float64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return a / b
+}
+
+func stdDev(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	m := mean(values)
+	sum := 0.0
+	for _, value := range values {
+		sum += (value - m) * (value - m)
+	}
+	return math.Sqrt(sum / float64(len(values)-1))
+}
+
+// downsideDev is the deviation of the losses below 0, the gains count as 0
+func downsideDev(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, value := range values {
+		if value < 0 {
+			sum += value * value
+		}
+	}
+	return math.Sqrt(sum / float64(len(values)))
+}
+
+// WriteReport writes the metrics and the trade stats as aligned tables
+func WriteReport(w io.Writer, report Report) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "period\t%s - %s\n", report.Start.UTC().Format("2006-01-02 15:04"), report.End.UTC().Format("2006-01-02 15:04"))
+	fmt.Fprintf(table, "equity\t%.2f -> %.2f\n", report.InitialEquity, report.FinalEquity)
+	fmt.Fprintf(table, "total return\t%.2f%%\n", 100*report.TotalReturn)
+	fmt.Fprintf(table, "CAGR\t%.2f%%\n", 100*report.CAGR)
+	fmt.Fprintf(table, "sharpe\t%.2f\n", report.Sharpe)
+	fmt.Fprintf(table, "sortino\t%.2f\n", report.Sortino)
+	fmt.Fprintf(table, "max drawdown\t%.2f%% over %d bars (%.1f days)\n", 100*report.MaxDrawdown, report.MaxDrawdownBars, report.MaxDrawdownDays)
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w)
+	table = tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "TRADES\tCOUNT\tWIN\tPNL\tFEES\tPF\tEXPECTANCY\tAVG R\tWIN STREAK\tLOSS STREAK\t")
+	groups := append(append([]TradeStats{report.Total}, report.ByType...), report.BySymbol...)
+	for _, stats := range groups {
+		fmt.Fprintf(table, "%s\t%d\t%.0f%%\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%d\t%d\t\n",
+			stats.Name, stats.Trades, 100*stats.WinRate, stats.PnL, stats.Fees, stats.ProfitFactor,
+			stats.Expectancy, stats.AverageR, stats.MaxWinStreak, stats.MaxLossStreak)
+	}
+	return table.Flush()
+}
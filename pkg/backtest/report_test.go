@@ -0,0 +1,164 @@
+package backtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/divergence/pkg/ta/divergence_detection"
+)
+
+func TestProfitFactor(t *testing.T) {
+	tests := []struct {
+		name string
+		pnl  []float64
+		want float64
+	}{
+		{"no trades", nil, 0},
+		{"wins and losses", []float64{30, -10, 20, -40}, 1},
+		{"only wins", []float64{10, 5}, math.Inf(1)},
+		{"only losses", []float64{-10, -5}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			trades := make([]Trade, len(test.pnl))
+			for i, pnl := range test.pnl {
+				trades[i] = Trade{PnL: pnl}
+			}
+			stats := tradeStats("all", trades)
+			if stats.ProfitFactor != test.want {
+				t.Errorf("profit factor %v, want %v", stats.ProfitFactor, test.want)
+			}
+			if _, err := json.Marshal(stats); err != nil {
+				t.Errorf("marshal: %v", err)
+			}
+		})
+	}
+}
+
+func TestInfiniteProfitFactorJSON(t *testing.T) {
+	data, err := json.Marshal(tradeStats("all", []Trade{{PnL: 10}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"profitFactor":null`) || strings.Count(string(data), "profitFactor") != 1 {
+		t.Errorf("got %s", data)
+	}
+}
+
+// testSimulation returns a daily equity curve of values starting with initial equity
+func testSimulation(initial float64, values ...float64) Simulation {
+	simulation := Simulation{Interval: 24 * time.Hour, InitialEquity: initial}
+	for i, value := range values {
+		simulation.Equity = append(simulation.Equity, EquityPoint{Time: start.Add(time.Duration(i) * 24 * time.Hour), Equity: value})
+	}
+	return simulation
+}
+
+func TestNewReport(t *testing.T) {
+	perYear := math.Sqrt(365)
+	tests := []struct {
+		name       string
+		simulation Simulation
+		want       Report
+	}{
+		{
+			// returns of 0.1, -0.1, 0 and 0.2 with a mean of 0.05, a standard deviation of sqrt(0.05/3) and a
+			// downside deviation of sqrt(0.01/4)
+			"known curve", testSimulation(100, 110, 99, 99, 118.8),
+			Report{
+				TotalReturn:     0.188,
+				CAGR:            math.Pow(1.188, 365.0/4) - 1,
+				Sharpe:          0.05 / math.Sqrt(0.05/3) * perYear,
+				Sortino:         0.05 / 0.05 * perYear,
+				MaxDrawdown:     0.1,
+				MaxDrawdownBars: 2,
+				MaxDrawdownDays: 2,
+			},
+		},
+		{
+			// the drawdown starts from the initial equity, before the first bar
+			"drawdown from the start", testSimulation(100, 90, 95, 101),
+			Report{
+				TotalReturn:     0.01,
+				CAGR:            math.Pow(1.01, 365.0/3) - 1,
+				Sharpe:          mean([]float64{-0.1, 95.0/90 - 1, 101.0/95 - 1}) / stdDev([]float64{-0.1, 95.0/90 - 1, 101.0/95 - 1}) * perYear,
+				Sortino:         mean([]float64{-0.1, 95.0/90 - 1, 101.0/95 - 1}) / math.Sqrt(0.01/3) * perYear,
+				MaxDrawdown:     0.1,
+				MaxDrawdownBars: 2,
+				MaxDrawdownDays: 2,
+			},
+		},
+		{"flat curve", testSimulation(100, 100, 100, 100), Report{}},
+		{"no bars", testSimulation(100), Report{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := NewReport(test.simulation)
+			got := []float64{report.TotalReturn, report.CAGR, report.Sharpe, report.Sortino, report.MaxDrawdown, report.MaxDrawdownDays}
+			want := []float64{test.want.TotalReturn, test.want.CAGR, test.want.Sharpe, test.want.Sortino, test.want.MaxDrawdown, test.want.MaxDrawdownDays}
+			for i := range got {
+				if math.Abs(got[i]-want[i]) > 1e-9*math.Max(1, math.Abs(want[i])) {
+					t.Errorf("total return, CAGR, sharpe, sortino, drawdown and drawdown days are %v, want %v", got, want)
+					break
+				}
+			}
+			if report.MaxDrawdownBars != test.want.MaxDrawdownBars {
+				t.Errorf("drawdown over %d bars, want %d", report.MaxDrawdownBars, test.want.MaxDrawdownBars)
+			}
+			if _, err := json.Marshal(report); err != nil {
+				t.Errorf("marshal: %v", err)
+			}
+		})
+	}
+}
+
+func TestReportGroups(t *testing.T) {
+	trade := func(symbol string, kind divergence_detection.Kind, direction divergence_detection.Direction, pnl float64) Trade {
+		return Trade{Symbol: symbol, Divergence: divergence_detection.Divergence{Kind: kind, Direction: direction}, PnL: pnl}
+	}
+	simulation := testSimulation(100, 100, 130)
+	simulation.Trades = []Trade{
+		trade("ETH", divergence_detection.Regular, divergence_detection.Bullish, 20),
+		trade("BTC", divergence_detection.Hidden, divergence_detection.Bearish, -10),
+		trade("BTC", divergence_detection.Regular, divergence_detection.Bullish, 20),
+	}
+
+	report := NewReport(simulation)
+	if report.Total.Trades != 3 || report.Total.Wins != 2 || report.Total.PnL != 30 || report.Total.ProfitFactor != 4 {
+		t.Errorf("total %+v", report.Total)
+	}
+
+	names := func(groups []TradeStats) []string {
+		result := []string{}
+		for _, stats := range groups {
+			result = append(result, fmt.Sprintf("%s %d %v", stats.Name, stats.Trades, stats.PnL))
+		}
+		return result
+	}
+	if got, want := names(report.ByType), []string{"hidden_bearish 1 -10", "regular_bullish 2 40"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("by type %v, want %v", got, want)
+	}
+	if got, want := names(report.BySymbol), []string{"BTC 2 10", "ETH 1 20"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("by symbol %v, want %v", got, want)
+	}
+}
+
+func TestEmptyReportJSON(t *testing.T) {
+	data, err := json.Marshal(NewReport(Simulation{InitialEquity: 100}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []string{"NaN", "Inf"} {
+		if strings.Contains(string(data), value) {
+			t.Errorf("%s in %s", value, data)
+		}
+	}
+	if !strings.Contains(string(data), `"byType":[]`) {
+		t.Errorf("got %s, want empty groups", data)
+	}
+}
@@ -0,0 +1,359 @@
+package backtest
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/divergence/pkg/models"
+	"github.com/divergence/pkg/ta/divergence_detection"
+	"github.com/markcheno/go-talib"
+)
+
+// StopMode selects where the stop of a trade is placed
+type StopMode int
+
+const (
+	// PivotStop places the stop beyond the second price pivot of the divergence
+	PivotStop StopMode = iota
+	// ATRStop places the stop ATRMultiple average true ranges away from the entry
+	ATRStop
+)
+
+func (m StopMode) String() string {
+	switch m {
+	case PivotStop:
+		return "pivot"
+	case ATRStop:
+		return "atr"
+	default:
+		return fmt.Sprintf("stop mode(%d)", int(m))
+	}
+}
+
+// Exit reasons of a trade
+const (
+	ExitStop   = "stop"
+	ExitTarget = "target"
+	ExitTime   = "time"
+	ExitEnd    = "end"
+)
+
+// SimulatorConfig holds the settings of Simulate. Fees and slippage are fractions of the traded value
+type SimulatorConfig struct {
+	Stop StopMode
+	// StopBuffer moves a pivot stop further away by this fraction of the pivot price
+	StopBuffer float64
+	// ATRPeriod and ATRMultiple size the stop of ATRStop, the ATR is the Wilder smoothed one of the signal bar
+	ATRPeriod   int
+	ATRMultiple float64
+	// TakeProfit is the target in multiples of the risk between entry and stop, 0 trades without a target
+	TakeProfit float64
+	// MaxBars closes a trade at the close of its MaxBars-th bar, 0 holds it until the stop or target
+	MaxBars int
+	// MakerFee is paid on targets, which are limit orders. TakerFee is paid on entries, stops and other exits
+	MakerFee float64
+	TakerFee float64
+	// Slippage moves the price of every market order against the trade
+	Slippage float64
+	// InitialEquity is the equity the simulation starts with
+	InitialEquity float64
+	// RiskPerTrade is the fraction of the equity lost when the stop is hit, before fees
+	RiskPerTrade float64
+	// MaxLeverage caps the position value at this multiple of the equity, 0 leaves it uncapped
+	MaxLeverage float64
+}
+
+// DefaultSimulatorConfig risks 1% per trade with a stop beyond the pivot and a 2R target, with Bybit's
+// base perpetual fees
+func DefaultSimulatorConfig() SimulatorConfig {
+	return SimulatorConfig{
+		Stop:          PivotStop,
+		ATRPeriod:     14,
+		ATRMultiple:   2,
+		TakeProfit:    2,
+		MakerFee:      0.0002,
+		TakerFee:      0.00055,
+		Slippage:      0.0005,
+		InitialEquity: 10000,
+		RiskPerTrade:  0.01,
+		MaxLeverage:   1,
+	}
+}
+
+func (c SimulatorConfig) validate() error {
+	if c.Stop < PivotStop || c.Stop > ATRStop {
+		return fmt.Errorf("unknown stop mode %d", int(c.Stop))
+	}
+	if c.Stop == ATRStop && (c.ATRPeriod < 1 || c.ATRMultiple <= 0) {
+		return fmt.Errorf("atr stop needs a period >= 1 and a multiple > 0, got %d and %v", c.ATRPeriod, c.ATRMultiple)
+	}
+	if c.StopBuffer < 0 || c.TakeProfit < 0 || c.MaxBars < 0 {
+		return errors.New("stop buffer, take profit and max bars must be >= 0")
+	}
+	if c.MakerFee < 0 || c.TakerFee < 0 || c.Slippage < 0 {
+		return errors.New("fees and slippage must be >= 0")
+	}
+	if c.InitialEquity <= 0 {
+		return fmt.Errorf("initial equity must be > 0, got %v", c.InitialEquity)
+	}
+	if c.RiskPerTrade <= 0 || c.RiskPerTrade > 1 {
+		return fmt.Errorf("risk per trade must be > 0 and <= 1, got %v", c.RiskPerTrade)
+	}
+	if c.MaxLeverage < 0 {
+		return fmt.Errorf("max leverage must be >= 0, got %v", c.MaxLeverage)
+	}
+	return nil
+}
+
+// Trade is one position opened on a divergence
+type Trade struct {
+	Symbol     string
+	Divergence divergence_detection.Divergence
+	// Long is true for bullish divergences
+	Long       bool
+	EntryIndex int
+	EntryTime  time.Time
+	EntryPrice float64
+	ExitIndex  int
+	ExitTime   time.Time
+	ExitPrice  float64
+	ExitReason string
+	Stop       float64
+	// Target is 0 without a take profit
+	Target float64
+	// Size is the position in units of the asset
+	Size float64
+	Fees float64
+	// PnL is the profit after fees
+	PnL float64
+	// R is the PnL in multiples of the amount risked
+	R float64
+	// Equity is the equity after the trade was closed
+	Equity float64
+}
+
+// EquityPoint is the equity at the close of a bar, open trades are valued at the close
+type EquityPoint struct {
+	Time   time.Time
+	Equity float64
+}
+
+// Simulation is the outcome of Simulate
+type Simulation struct {
+	// Interval is the length of the bars of the equity curve
+	Interval      time.Duration
+	InitialEquity float64
+	Trades        []Trade
+	Equity        []EquityPoint
+	// Skipped counts the divergences that were not traded, because a trade was open or the stop was on the
+	// wrong side of the entry
+	Skipped int
+}
+
+// Simulate trades the divergences of asset one at a time. A trade is entered at the open of the bar after
+// the confirmation, bars that reach both the stop and the target are taken as stopped out
+func Simulate(symbol string, asset models.Asset, divergences []divergence_detection.Divergence, config SimulatorConfig) (Simulation, error) {
+	if err := config.validate(); err != nil {
+		return Simulation{}, err
+	}
+	n := asset.Len()
+	if len(asset.Opening) != n || len(asset.High) != n || len(asset.Low) != n {
+		return Simulation{}, errors.New("simulating trades needs the open, high and low of every bar")
+	}
+
+	var atr []float64
+	if config.Stop == ATRStop {
+		// not the ATR of ta.CalcActualTrueRange: that one is a simple moving average of the true range from
+		// cinar/indicator, which is not a dependency of this module, while talib smooths it like Wilder did
+		atr = talib.Atr(asset.High, asset.Low, asset.Closing, config.ATRPeriod)
+	}
+
+	signals := append([]divergence_detection.Divergence(nil), divergences...)
+	sort.SliceStable(signals, func(i, j int) bool { return signals[i].ConfirmationIndex < signals[j].ConfirmationIndex })
+
+	simulation := Simulation{
+		Interval:      asset.Interval,
+		InitialEquity: config.InitialEquity,
+		Trades:        []Trade{},
+		Equity:        make([]EquityPoint, 0, n),
+	}
+	equity := config.InitialEquity
+	var open *Trade
+	next := 0
+
+	for i := 0; i < n; i++ {
+		if open != nil {
+			if closeTrade(open, asset, i, config) {
+				equity += open.PnL
+				open.Equity = equity
+				simulation.Trades = append(simulation.Trades, *open)
+				open = nil
+			}
+		}
+
+		// signals confirmed on this bar are entered at the open of the next one
+		for ; next < len(signals) && signals[next].ConfirmationIndex <= i; next++ {
+			signal := signals[next]
+			if open != nil || i+1 >= n {
+				simulation.Skipped++
+				continue
+			}
+			trade, ok := openTrade(symbol, signal, asset, atr, equity, config)
+			if !ok {
+				simulation.Skipped++
+				continue
+			}
+			open = &trade
+		}
+
+		marked := equity
+		if open != nil && open.EntryIndex <= i {
+			marked += open.direction()*open.Size*(asset.Closing[i]-open.EntryPrice) - open.Fees
+		}
+		simulation.Equity = append(simulation.Equity, EquityPoint{Time: asset.Date[i], Equity: marked})
+	}
+
+	if open != nil {
+		exit(open, asset, n-1, fill(asset.Closing[n-1], -open.direction(), config.Slippage), config.TakerFee, ExitEnd)
+		equity += open.PnL
+		open.Equity = equity
+		simulation.Trades = append(simulation.Trades, *open)
+		simulation.Equity[n-1].Equity = equity
+	}
+
+	return simulation, nil
+}
+
+func (t Trade) direction() float64 {
+	if t.Long {
+		return 1
+	}
+	return -1
+}
+
+// openTrade sizes a trade entered at the open of the bar after the confirmation of d
+func openTrade(symbol string, d divergence_detection.Divergence, asset models.Asset, atr []float64, equity float64, config SimulatorConfig) (Trade, bool) {
+	entry := d.ConfirmationIndex + 1
+	trade := Trade{
+		Symbol:     symbol,
+		Divergence: d,
+		Long:       d.Direction == divergence_detection.Bullish,
+		EntryIndex: entry,
+		EntryTime:  asset.Date[entry],
+	}
+	trade.EntryPrice = fill(asset.Opening[entry], trade.direction(), config.Slippage)
+
+	switch config.Stop {
+	case PivotStop:
+		pivot := d.PricePivots[1].Value
+		trade.Stop = pivot * (1 - trade.direction()*config.StopBuffer)
+	case ATRStop:
+		trade.Stop = trade.EntryPrice - trade.direction()*config.ATRMultiple*atr[d.ConfirmationIndex]
+	}
+
+	risk := trade.direction() * (trade.EntryPrice - trade.Stop)
+	if risk <= 0 || math.IsNaN(risk) || equity <= 0 {
+		return Trade{}, false
+	}
+	if config.TakeProfit > 0 {
+		trade.Target = trade.EntryPrice + trade.direction()*config.TakeProfit*risk
+	}
+
+	trade.Size = equity * config.RiskPerTrade / risk
+	if config.MaxLeverage > 0 {
+		trade.Size = math.Min(trade.Size, equity*config.MaxLeverage/trade.EntryPrice)
+	}
+	trade.Fees = trade.Size * trade.EntryPrice * config.TakerFee
+	return trade, true
+}
+
+// closeTrade checks whether bar i ends the trade and fills the exit when it does
+func closeTrade(trade *Trade, asset models.Asset, i int, config SimulatorConfig) bool {
+	if i < trade.EntryIndex {
+		return false
+	}
+	direction := trade.direction()
+	open, high, low := asset.Opening[i], asset.High[i], asset.Low[i]
+	adverse, favorable := low, high
+	if !trade.Long {
+		adverse, favorable = high, low
+	}
+
+	switch {
+	case direction*(adverse-trade.Stop) <= 0:
+		// a gap through the stop is filled at the open
+		price := trade.Stop
+		if i > trade.EntryIndex && direction*(open-trade.Stop) < 0 {
+			price = open
+		}
+		exit(trade, asset, i, fill(price, -direction, config.Slippage), config.TakerFee, ExitStop)
+	case trade.Target > 0 && direction*(favorable-trade.Target) >= 0:
+		price := trade.Target
+		if i > trade.EntryIndex && direction*(open-trade.Target) > 0 {
+			price = open
+		}
+		exit(trade, asset, i, price, config.MakerFee, ExitTarget)
+	case config.MaxBars > 0 && i-trade.EntryIndex+1 >= config.MaxBars:
+		exit(trade, asset, i, fill(asset.Closing[i], -direction, config.Slippage), config.TakerFee, ExitTime)
+	default:
+		return false
+	}
+	return true
+}
+
+func exit(trade *Trade, asset models.Asset, i int, price, fee float64, reason string) {
+	trade.ExitIndex = i
+	trade.ExitTime = asset.Date[i]
+	trade.ExitPrice = price
+	trade.ExitReason = reason
+	trade.Fees += trade.Size * price * fee
+	trade.PnL = trade.direction()*trade.Size*(price-trade.EntryPrice) - trade.Fees
+	trade.R = trade.PnL / (trade.Size * math.Abs(trade.EntryPrice-trade.Stop))
+}
+
+// fill moves price against an order that buys for a direction of 1 and sells for -1
+func fill(price, direction, slippage float64) float64 {
+	return price * (1 + direction*slippage)
+}
+
+// WriteTrades writes the trade log as CSV
+func WriteTrades(w io.Writer, trades []Trade) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"symbol", "type", "side", "entryTime", "entryPrice", "stop", "target", "size", "exitTime", "exitPrice", "exitReason", "fees", "pnl", "r", "equity"})
+	for _, t := range trades {
+		side := "short"
+		if t.Long {
+			side = "long"
+		}
+		writer.Write([]string{
+			t.Symbol, t.Divergence.Type(), side,
+			t.EntryTime.UTC().Format(time.RFC3339), formatFloat(t.EntryPrice),
+			formatFloat(t.Stop), formatFloat(t.Target), formatFloat(t.Size),
+			t.ExitTime.UTC().Format(time.RFC3339), formatFloat(t.ExitPrice), t.ExitReason,
+			formatFloat(t.Fees), formatFloat(t.PnL), formatFloat(t.R), formatFloat(t.Equity),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteEquity writes the equity curve as CSV
+func WriteEquity(w io.Writer, equity []EquityPoint) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"time", "equity"})
+	for _, point := range equity {
+		writer.Write([]string{point.Time.UTC().Format(time.RFC3339), formatFloat(point.Equity)})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,229 @@
+package backtest
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/divergence/pkg/common"
+	"github.com/divergence/pkg/models"
+	"github.com/divergence/pkg/ta/divergence_detection"
+)
+
+var start = time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)
+
+// testAsset returns an hourly asset with the open, high, low and close of bars
+func testAsset(bars ...[4]float64) models.Asset {
+	candles := make([]*models.Candle, len(bars))
+	for i, bar := range bars {
+		open := start.Add(time.Duration(i) * time.Hour)
+		candles[i] = &models.Candle{
+			Open:       bar[0],
+			High:       bar[1],
+			Low:        bar[2],
+			Close:      bar[3],
+			BaseVolume: 1,
+			OpenTime:   common.Int64ToString(open.UnixMilli()),
+			CloseTime:  open.Add(time.Hour).Unix(),
+			Interval:   time.Hour,
+		}
+	}
+	return models.AssetFromCandles(candles)
+}
+
+// testDivergence is confirmed on bar confirmation with its second price pivot at pivot
+func testDivergence(direction divergence_detection.Direction, pivot float64, confirmation int) divergence_detection.Divergence {
+	d := divergence_detection.Divergence{Direction: direction, ConfirmationIndex: confirmation}
+	d.PricePivots[1] = divergence_detection.Pivot{Index: confirmation - 1, Value: pivot}
+	return d
+}
+
+// testSimulatorConfig risks 100 of 10000 with a 2R target, without fees and slippage
+func testSimulatorConfig() SimulatorConfig {
+	return SimulatorConfig{
+		Stop:          PivotStop,
+		TakeProfit:    2,
+		InitialEquity: 10000,
+		RiskPerTrade:  0.01,
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestSimulateExits(t *testing.T) {
+	// a long is entered at 100 on bar 2 with its stop at 95 and its target at 110, a short at 100 with its
+	// stop at 105 and its target at 90
+	before := [][4]float64{{100, 101, 99, 100}, {100, 101, 99, 100}, {100, 101, 99, 100}}
+	quiet := [4]float64{100, 102, 98, 101}
+
+	tests := []struct {
+		name      string
+		direction divergence_detection.Direction
+		maxBars   int
+		bars      [][4]float64
+		reason    string
+		exitIndex int
+		exit      float64
+	}{
+		{"long stop", divergence_detection.Bullish, 0, [][4]float64{{100, 101, 94, 96}}, ExitStop, 3, 95},
+		{"long target", divergence_detection.Bullish, 0, [][4]float64{{100, 111, 99, 108}}, ExitTarget, 3, 110},
+		{"long stop and target on one bar", divergence_detection.Bullish, 0, [][4]float64{{100, 111, 94, 100}}, ExitStop, 3, 95},
+		{"long gap through the stop", divergence_detection.Bullish, 0, [][4]float64{{93, 94, 92, 93}}, ExitStop, 3, 93},
+		{"long gap through the target", divergence_detection.Bullish, 0, [][4]float64{{112, 113, 111, 112}}, ExitTarget, 3, 112},
+		{"long end of data", divergence_detection.Bullish, 0, [][4]float64{quiet, quiet}, ExitEnd, 4, 101},
+		{"long max bars", divergence_detection.Bullish, 2, [][4]float64{quiet, quiet, quiet}, ExitTime, 3, 101},
+		{"short stop", divergence_detection.Bearish, 0, [][4]float64{{100, 106, 99, 104}}, ExitStop, 3, 105},
+		{"short target", divergence_detection.Bearish, 0, [][4]float64{{100, 101, 89, 92}}, ExitTarget, 3, 90},
+		{"short stop and target on one bar", divergence_detection.Bearish, 0, [][4]float64{{100, 106, 89, 100}}, ExitStop, 3, 105},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			asset := testAsset(append(append([][4]float64{}, before...), test.bars...)...)
+			pivot := 95.0
+			if test.direction == divergence_detection.Bearish {
+				pivot = 105
+			}
+			config := testSimulatorConfig()
+			config.MaxBars = test.maxBars
+
+			simulation, err := Simulate("TEST", asset, []divergence_detection.Divergence{testDivergence(test.direction, pivot, 1)}, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(simulation.Trades) != 1 {
+				t.Fatalf("got %d trades, want 1", len(simulation.Trades))
+			}
+			trade := simulation.Trades[0]
+			if trade.EntryIndex != 2 || trade.EntryPrice != 100 || !near(trade.Size, 20) {
+				t.Errorf("entered on bar %d at %v with size %v, want bar 2 at 100 with size 20", trade.EntryIndex, trade.EntryPrice, trade.Size)
+			}
+			if trade.ExitReason != test.reason || trade.ExitIndex != test.exitIndex || !near(trade.ExitPrice, test.exit) {
+				t.Errorf("exit %s on bar %d at %v, want %s on bar %d at %v", trade.ExitReason, trade.ExitIndex, trade.ExitPrice, test.reason, test.exitIndex, test.exit)
+			}
+
+			pnl := trade.direction() * 20 * (test.exit - 100)
+			if !near(trade.PnL, pnl) || !near(trade.R, pnl/100) || !near(trade.Equity, 10000+pnl) {
+				t.Errorf("pnl %v, r %v and equity %v, want %v, %v and %v", trade.PnL, trade.R, trade.Equity, pnl, pnl/100, 10000+pnl)
+			}
+			if last := simulation.Equity[len(simulation.Equity)-1].Equity; !near(last, 10000+pnl) {
+				t.Errorf("equity curve ends at %v, want %v", last, 10000+pnl)
+			}
+		})
+	}
+}
+
+func TestSimulateFeesAndSlippage(t *testing.T) {
+	const taker, maker, slippage = 0.001, 0.0005, 0.01
+
+	tests := []struct {
+		name      string
+		direction divergence_detection.Direction
+		pivot     float64
+		bar       [4]float64
+		// entry, stop and target with slippage, exit is the price the trade is closed at
+		entry, stop, target, exit float64
+		exitFee                   float64
+	}{
+		// long entry 101, risk 6, target 113, the stop sells at 95 minus slippage
+		{"long stop", divergence_detection.Bullish, 95, [4]float64{100, 101, 94, 96}, 101, 95, 113, 95 * 0.99, taker},
+		// a target is a limit order without slippage and pays the maker fee
+		{"long target", divergence_detection.Bullish, 95, [4]float64{100, 114, 99, 108}, 101, 95, 113, 113, maker},
+		// short entry 99, risk 6, target 87, the stop buys at 105 plus slippage
+		{"short stop", divergence_detection.Bearish, 105, [4]float64{100, 106, 99, 104}, 99, 105, 87, 105 * 1.01, taker},
+		{"short target", divergence_detection.Bearish, 105, [4]float64{100, 101, 86, 92}, 99, 105, 87, 87, maker},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			asset := testAsset([4]float64{100, 101, 99, 100}, [4]float64{100, 101, 99, 100}, [4]float64{100, 101, 99, 100}, test.bar)
+			config := testSimulatorConfig()
+			config.TakerFee, config.MakerFee, config.Slippage = taker, maker, slippage
+
+			simulation, err := Simulate("TEST", asset, []divergence_detection.Divergence{testDivergence(test.direction, test.pivot, 1)}, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(simulation.Trades) != 1 {
+				t.Fatalf("got %d trades, want 1", len(simulation.Trades))
+			}
+			trade := simulation.Trades[0]
+			if !near(trade.EntryPrice, test.entry) || !near(trade.Stop, test.stop) || !near(trade.Target, test.target) {
+				t.Errorf("entry %v, stop %v and target %v, want %v, %v and %v", trade.EntryPrice, trade.Stop, trade.Target, test.entry, test.stop, test.target)
+			}
+			if !near(trade.ExitPrice, test.exit) {
+				t.Errorf("exit at %v, want %v", trade.ExitPrice, test.exit)
+			}
+
+			size := 100 / 6.0
+			fees := size*test.entry*taker + size*test.exit*test.exitFee
+			pnl := trade.direction()*size*(test.exit-test.entry) - fees
+			if !near(trade.Size, size) || !near(trade.Fees, fees) || !near(trade.PnL, pnl) {
+				t.Errorf("size %v, fees %v and pnl %v, want %v, %v and %v", trade.Size, trade.Fees, trade.PnL, size, fees, pnl)
+			}
+		})
+	}
+}
+
+func TestSimulateATRStop(t *testing.T) {
+	// the true ranges of bars 1 to 4 are 4, 4, 6 and 4. The Wilder ATR over 3 bars starts at their mean of
+	// 14/3 on bar 3 and is (14/3*2+4)/3 = 40/9 on bar 4. A simple moving average would be 14/3 there
+	asset := testAsset(
+		[4]float64{100, 102, 98, 101},
+		[4]float64{101, 104, 100, 103},
+		[4]float64{103, 103, 99, 100},
+		[4]float64{100, 101, 95, 96},
+		[4]float64{96, 100, 96, 99},
+		[4]float64{99, 100, 98, 99},
+		[4]float64{99, 99, 90, 91},
+	)
+	config := testSimulatorConfig()
+	config.Stop = ATRStop
+	config.ATRPeriod = 3
+	config.ATRMultiple = 2
+
+	simulation, err := Simulate("TEST", asset, []divergence_detection.Divergence{testDivergence(divergence_detection.Bullish, 0, 4)}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(simulation.Trades) != 1 {
+		t.Fatalf("got %d trades, want 1", len(simulation.Trades))
+	}
+	trade := simulation.Trades[0]
+	stop := 99 - 2*40/9.0
+	if trade.EntryIndex != 5 || !near(trade.Stop, stop) {
+		t.Errorf("entered on bar %d with the stop at %v, want bar 5 with the stop at %v", trade.EntryIndex, trade.Stop, stop)
+	}
+	if trade.ExitReason != ExitStop || trade.ExitIndex != 6 || !near(trade.ExitPrice, stop) {
+		t.Errorf("exit %s on bar %d at %v, want stop on bar 6 at %v", trade.ExitReason, trade.ExitIndex, trade.ExitPrice, stop)
+	}
+}
+
+func TestSimulateSkips(t *testing.T) {
+	quiet := [4]float64{100, 102, 98, 101}
+	asset := testAsset(quiet, quiet, quiet, quiet, quiet, quiet)
+
+	tests := []struct {
+		name            string
+		divergences     []divergence_detection.Divergence
+		trades, skipped int
+	}{
+		{"trade open", []divergence_detection.Divergence{
+			testDivergence(divergence_detection.Bullish, 95, 1),
+			testDivergence(divergence_detection.Bearish, 105, 2),
+		}, 1, 1},
+		{"stop above the entry of a long", []divergence_detection.Divergence{testDivergence(divergence_detection.Bullish, 105, 1)}, 0, 1},
+		{"no bar left to enter on", []divergence_detection.Divergence{testDivergence(divergence_detection.Bullish, 95, 5)}, 0, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			simulation, err := Simulate("TEST", asset, test.divergences, testSimulatorConfig())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(simulation.Trades) != test.trades || simulation.Skipped != test.skipped {
+				t.Errorf("got %d trades and %d skipped, want %d and %d", len(simulation.Trades), simulation.Skipped, test.trades, test.skipped)
+			}
+		})
+	}
+}
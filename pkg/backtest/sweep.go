@@ -0,0 +1,243 @@
+package backtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/divergence/pkg/models"
+	"github.com/divergence/pkg/ta/divergence_detection"
+)
+
+// Params are the detector settings a sweep varies
+type Params struct {
+	Order              int `json:"order"`
+	ChainLength        int `json:"k"`
+	Period             int `json:"period"`
+	AlignmentTolerance int `json:"tolerance"`
+	// Lookback re-runs the detector on every bar over this many bars, 0 runs it once
+	Lookback int `json:"lookback"`
+}
+
+func (p Params) String() string {
+	return fmt.Sprintf("order %d, k %d, period %d, tolerance %d, lookback %d", p.Order, p.ChainLength, p.Period, p.AlignmentTolerance, p.Lookback)
+}
+
+// Grid lists the values of every parameter, an empty list keeps the value of the base params
+type Grid struct {
+	Order              []int
+	ChainLength        []int
+	Period             []int
+	AlignmentTolerance []int
+	Lookback           []int
+}
+
+// Params returns every combination of the grid
+func (g Grid) Params(base Params) []Params {
+	params := []Params{base}
+	expand := func(values []int, set func(*Params, int)) {
+		if len(values) == 0 {
+			return
+		}
+		expanded := make([]Params, 0, len(params)*len(values))
+		for _, p := range params {
+			for _, value := range values {
+				set(&p, value)
+				expanded = append(expanded, p)
+			}
+		}
+		params = expanded
+	}
+	expand(g.Order, func(p *Params, v int) { p.Order = v })
+	expand(g.ChainLength, func(p *Params, v int) { p.ChainLength = v })
+	expand(g.Period, func(p *Params, v int) { p.Period = v })
+	expand(g.AlignmentTolerance, func(p *Params, v int) { p.AlignmentTolerance = v })
+	expand(g.Lookback, func(p *Params, v int) { p.Lookback = v })
+	return params
+}
+
+// Sample returns n different combinations of the grid picked at random, or all of them when there are fewer
+func (g Grid) Sample(base Params, n int, rng *rand.Rand) []Params {
+	params := g.Params(base)
+	rng.Shuffle(len(params), func(i, j int) { params[i], params[j] = params[j], params[i] })
+	return params[:min(n, len(params))]
+}
+
+// SweepOptions holds the settings shared by every run of a sweep
+type SweepOptions struct {
+	// Detector is the base config, the params replace its order, chain length and alignment tolerance
+	Detector divergence_detection.DetectorConfig
+	// Oscillator is the name of the oscillator built with the period of the params
+	Oscillator string
+	Simulator  SimulatorConfig
+	// Workers is the number of runs at the same time, 0 uses one per CPU
+	Workers int
+}
+
+// SweepResult is the outcome of one combination of params
+type SweepResult struct {
+	Params Params `json:"params"`
+	Report Report `json:"report"`
+}
+
+// Evaluate detects the divergences of asset with params and trades them
+func (o SweepOptions) Evaluate(symbol string, asset models.Asset, params Params) (Simulation, error) {
+	divergences, err := o.detect(asset, params)
+	if err != nil {
+		return Simulation{}, err
+	}
+	return Simulate(symbol, asset, divergences, o.Simulator)
+}
+
+// detect returns the divergences of asset found with params
+func (o SweepOptions) detect(asset models.Asset, params Params) ([]divergence_detection.Divergence, error) {
+	config := o.Detector
+	config.Window = 0
+	config.Order = params.Order
+	config.ChainLength = params.ChainLength
+	config.AlignmentTolerance = params.AlignmentTolerance
+	oscillator, err := divergence_detection.OscillatorByName(o.Oscillator, params.Period)
+	if err != nil {
+		return nil, err
+	}
+	config.Oscillator = oscillator
+
+	detector, err := divergence_detection.NewDetector(config)
+	if err != nil {
+		return nil, err
+	}
+	return detect(detector, asset, params.Lookback)
+}
+
+// Sweep evaluates every combination of params on asset on a bounded number of workers. Combinations that
+// fail, like an order too large for the score config, do not stop the others, their errors are joined
+// into the returned error. The results are in the order of params
+func Sweep(ctx context.Context, symbol string, asset models.Asset, params []Params, options SweepOptions) ([]SweepResult, error) {
+	if options.Workers <= 0 {
+		options.Workers = runtime.NumCPU()
+	}
+
+	queue := make(chan int)
+	reports := make([]*Report, len(params))
+	var mu sync.Mutex
+	var errs []error
+
+	var wg sync.WaitGroup
+	for range min(options.Workers, max(len(params), 1)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				simulation, err := options.Evaluate(symbol, asset, params[i])
+				if err != nil {
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("%v: %w", params[i], err))
+					mu.Unlock()
+					continue
+				}
+				report := NewReport(simulation)
+				reports[i] = &report
+			}
+		}()
+	}
+
+enqueue:
+	for i := range params {
+		select {
+		case queue <- i:
+		case <-ctx.Done():
+			break enqueue
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		errs = append(errs, ctx.Err())
+	}
+
+	results := []SweepResult{}
+	for i, report := range reports {
+		if report != nil {
+			results = append(results, SweepResult{Params: params[i], Report: *report})
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// metrics are the report values results can be ranked by, drawdown is the only one where lower is better
+var metrics = map[string]func(Report) float64{
+	"return":        func(r Report) float64 { return r.TotalReturn },
+	"cagr":          func(r Report) float64 { return r.CAGR },
+	"sharpe":        func(r Report) float64 { return r.Sharpe },
+	"sortino":       func(r Report) float64 { return r.Sortino },
+	"drawdown":      func(r Report) float64 { return r.MaxDrawdown },
+	"profit-factor": func(r Report) float64 { return r.Total.ProfitFactor },
+	"expectancy":    func(r Report) float64 { return r.Total.Expectancy },
+	"avg-r":         func(r Report) float64 { return r.Total.AverageR },
+	"win-rate":      func(r Report) float64 { return r.Total.WinRate },
+	"trades":        func(r Report) float64 { return float64(r.Total.Trades) },
+}
+
+// Metrics returns the names of the metrics results can be ranked by
+func Metrics() []string {
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Metric returns the value of the metric called name, like sharpe or profit-factor
+func Metric(report Report, name string) (float64, error) {
+	metric, ok := metrics[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown metric %q", name)
+	}
+	return metric(report), nil
+}
+
+// RankSweep orders results by the metric called name, the best first. Ties, like several infinite profit
+// factors of runs without a losing trade, are ordered by the total return and then keep their order
+func RankSweep(results []SweepResult, name string) error {
+	metric, ok := metrics[name]
+	if !ok {
+		return fmt.Errorf("unknown metric %q", name)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := metric(results[i].Report), metric(results[j].Report)
+		if a == b {
+			return results[i].Report.TotalReturn > results[j].Report.TotalReturn
+		}
+		if name == "drawdown" {
+			return a < b
+		}
+		return a > b
+	})
+	return nil
+}
+
+// WriteSweep writes results as an aligned table with the ranking metric in the first column
+func WriteSweep(w io.Writer, results []SweepResult, name string) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(table, "%s\tORDER\tK\tPERIOD\tTOLERANCE\tLOOKBACK\tTRADES\tRETURN\tSHARPE\tMAX DD\tPF\tWIN\t\n", strings.ToUpper(name))
+	for _, result := range results {
+		value, err := Metric(result.Report, name)
+		if err != nil {
+			return err
+		}
+		p, r := result.Params, result.Report
+		fmt.Fprintf(table, "%.4g\t%d\t%d\t%d\t%d\t%d\t%d\t%.2f%%\t%.2f\t%.2f%%\t%.2f\t%.0f%%\t\n",
+			value, p.Order, p.ChainLength, p.Period, p.AlignmentTolerance, p.Lookback,
+			r.Total.Trades, 100*r.TotalReturn, r.Sharpe, 100*r.MaxDrawdown, r.Total.ProfitFactor, 100*r.Total.WinRate)
+	}
+	return table.Flush()
+}
@@ -0,0 +1,172 @@
+package backtest
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGridParams(t *testing.T) {
+	base := Params{Order: 4, ChainLength: 2, Period: 14, AlignmentTolerance: 1, Lookback: 0}
+	grid := Grid{Order: []int{3, 4, 5}, ChainLength: []int{2, 3}, Lookback: []int{0, 100}}
+
+	params := grid.Params(base)
+	if len(params) != 3*2*2 {
+		t.Fatalf("got %d combinations, want 12", len(params))
+	}
+	seen := map[Params]bool{}
+	for _, p := range params {
+		seen[p] = true
+	}
+	for _, order := range grid.Order {
+		for _, k := range grid.ChainLength {
+			for _, lookback := range grid.Lookback {
+				want := Params{Order: order, ChainLength: k, Period: 14, AlignmentTolerance: 1, Lookback: lookback}
+				if !seen[want] {
+					t.Errorf("missing %v", want)
+				}
+			}
+		}
+	}
+
+	if got := (Grid{}).Params(base); !reflect.DeepEqual(got, []Params{base}) {
+		t.Errorf("an empty grid returned %v, want the base params", got)
+	}
+}
+
+func TestGridSample(t *testing.T) {
+	grid := Grid{Order: []int{3, 4, 5}, Period: []int{9, 14, 21}}
+	all := map[Params]bool{}
+	for _, p := range grid.Params(Params{ChainLength: 2}) {
+		all[p] = true
+	}
+
+	sample := grid.Sample(Params{ChainLength: 2}, 4, rand.New(rand.NewSource(1)))
+	seen := map[Params]bool{}
+	for _, p := range sample {
+		if !all[p] || seen[p] {
+			t.Errorf("%v is not a new combination of the grid", p)
+		}
+		seen[p] = true
+	}
+	if len(sample) != 4 {
+		t.Errorf("got %d combinations, want 4", len(sample))
+	}
+
+	if sample := grid.Sample(Params{ChainLength: 2}, 100, rand.New(rand.NewSource(1))); len(sample) != len(all) {
+		t.Errorf("got %d combinations, want all %d", len(sample), len(all))
+	}
+}
+
+func testSweepOptions() SweepOptions {
+	return SweepOptions{
+		Detector:   DefaultOptions().Detector,
+		Oscillator: "rsi",
+		Simulator:  DefaultSimulatorConfig(),
+		Workers:    2,
+	}
+}
+
+func TestSweepFailures(t *testing.T) {
+	asset := loadAsset(t)
+	// a chain of one pivot is not a valid config
+	params := []Params{
+		{Order: 3, ChainLength: 2, Period: 14},
+		{Order: 3, ChainLength: 1, Period: 14},
+		{Order: 4, ChainLength: 2, Period: 14},
+		{Order: 4, ChainLength: 1, Period: 14},
+	}
+
+	results, err := Sweep(context.Background(), "BTC", asset, params, testSweepOptions())
+	if err == nil {
+		t.Fatal("no error")
+	}
+	if strings.Count(err.Error(), "chain length") != 2 {
+		t.Errorf("error %q, want one for each failed combination", err)
+	}
+	if len(results) != 2 || results[0].Params != params[0] || results[1].Params != params[2] {
+		t.Fatalf("got %v, want the results of the valid combinations in order", results)
+	}
+
+	for _, result := range results {
+		simulation, err := testSweepOptions().Evaluate("BTC", asset, result.Params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := NewReport(simulation); !reflect.DeepEqual(result.Report, want) {
+			t.Errorf("%v: the sweep report differs from a single run", result.Params)
+		}
+	}
+}
+
+func TestSweepCancelled(t *testing.T) {
+	asset := loadAsset(t)
+	params := Grid{Order: []int{3, 4, 5, 6}, Period: []int{7, 9, 14, 21}, AlignmentTolerance: []int{0, 1}}.Params(Params{ChainLength: 2})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	options := testSweepOptions()
+	options.Workers = 1
+	results, err := Sweep(ctx, "BTC", asset, params, options)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error %v, want context.Canceled", err)
+	}
+	// a worker may still take a combination before the cancellation is seen
+	if len(results) == len(params) {
+		t.Errorf("all %d combinations ran", len(params))
+	}
+}
+
+func TestRankSweep(t *testing.T) {
+	// the order of the params tells the results apart
+	result := func(order int, totalReturn, drawdown, profitFactor float64) SweepResult {
+		report := Report{TotalReturn: totalReturn, MaxDrawdown: drawdown}
+		report.Total.ProfitFactor = profitFactor
+		return SweepResult{Params: Params{Order: order}, Report: report}
+	}
+	orders := func(results []SweepResult) []int {
+		orders := []int{}
+		for _, r := range results {
+			orders = append(orders, r.Params.Order)
+		}
+		return orders
+	}
+	results := func() []SweepResult {
+		return []SweepResult{
+			result(1, 0.1, 0.2, 1.5),
+			result(2, 0.3, 0.1, math.Inf(1)),
+			result(3, 0.2, 0.3, 3),
+			result(4, 0.5, 0.1, math.Inf(1)),
+		}
+	}
+
+	tests := []struct {
+		metric string
+		want   []int
+	}{
+		{"return", []int{4, 2, 3, 1}},
+		// the lowest drawdown first, the higher return on a tie
+		{"drawdown", []int{4, 2, 1, 3}},
+		// runs without losing trades first, the higher return on a tie
+		{"profit-factor", []int{4, 2, 3, 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.metric, func(t *testing.T) {
+			ranked := results()
+			if err := RankSweep(ranked, test.metric); err != nil {
+				t.Fatal(err)
+			}
+			if got := orders(ranked); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	if err := RankSweep(results(), "luck"); err == nil {
+		t.Error("no error for an unknown metric")
+	}
+}
@@ -0,0 +1,270 @@
+package backtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/divergence/pkg/models"
+	"github.com/divergence/pkg/ta/divergence_detection"
+)
+
+// WalkForwardOptions holds the settings of a walk-forward analysis
+type WalkForwardOptions struct {
+	// Sweep runs the candidates, its Simulator also trades the out-of-sample windows
+	Sweep SweepOptions
+	// Candidates are the params the in-sample windows choose from
+	Candidates []Params
+	// Metric is the name of the metric the best in-sample params are chosen by, like sharpe
+	Metric string
+	// InSample and OutOfSample are the lengths of the windows in bars. The windows move on by OutOfSample
+	// bars, so the out-of-sample windows follow each other without overlapping
+	InSample    int
+	OutOfSample int
+	// Anchored keeps the in-sample windows starting at the first bar, so they grow instead of roll
+	Anchored bool
+}
+
+// WalkForwardWindow is one in-sample window and the out-of-sample window after it
+type WalkForwardWindow struct {
+	InSampleStart    time.Time `json:"inSampleStart"`
+	OutOfSampleStart time.Time `json:"outOfSampleStart"`
+	// OutOfSampleEnd is the start of the last bar of the out-of-sample window
+	OutOfSampleEnd time.Time `json:"outOfSampleEnd"`
+	// Params are the candidates that did best in sample
+	Params      Params `json:"params"`
+	InSample    Report `json:"inSample"`
+	OutOfSample Report `json:"outOfSample"`
+}
+
+// ParamStability describes how much one parameter changed between the windows
+type ParamStability struct {
+	Name   string  `json:"name"`
+	Values []int   `json:"values"`
+	Min    int     `json:"min"`
+	Max    int     `json:"max"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stdDev"`
+	// Mode is the most chosen value, the smaller one on a tie, and ModeShare the fraction of windows choosing it
+	Mode      int     `json:"mode"`
+	ModeShare float64 `json:"modeShare"`
+	// Changes counts the windows that chose another value than the one before
+	Changes int `json:"changes"`
+}
+
+// WalkForwardResult holds every window and the out-of-sample windows stitched together
+type WalkForwardResult struct {
+	Windows []WalkForwardWindow `json:"windows"`
+	// Simulation holds the out-of-sample trades and equity of all windows, each window starting with the
+	// equity the one before ended with. Trade indices refer to the whole asset
+	Simulation Simulation       `json:"-"`
+	Report     Report           `json:"report"`
+	Stability  []ParamStability `json:"stability"`
+}
+
+// WalkForward chooses the best candidates on every in-sample window and trades them on the out-of-sample
+// window after it. The detector sees the in-sample bars as history in the out-of-sample window, but only
+// divergences confirmed within the out-of-sample window are traded, and open trades are closed at its end.
+// Candidates that fail in a window are left out of it and their errors are joined into the returned error.
+// When a window cannot be completed, the result holds the windows before it
+func WalkForward(ctx context.Context, symbol string, asset models.Asset, options WalkForwardOptions) (WalkForwardResult, error) {
+	if options.InSample < 1 || options.OutOfSample < 1 {
+		return WalkForwardResult{}, fmt.Errorf("window lengths must be >= 1, got %d in sample and %d out of sample", options.InSample, options.OutOfSample)
+	}
+	if asset.Len() < options.InSample+options.OutOfSample {
+		return WalkForwardResult{}, fmt.Errorf("%d bars are not enough for a window of %d in sample and %d out of sample bars",
+			asset.Len(), options.InSample, options.OutOfSample)
+	}
+	if len(options.Candidates) == 0 {
+		return WalkForwardResult{}, errors.New("no candidates")
+	}
+	if _, err := Metric(Report{}, options.Metric); err != nil {
+		return WalkForwardResult{}, err
+	}
+	if err := options.Sweep.Simulator.validate(); err != nil {
+		return WalkForwardResult{}, err
+	}
+
+	result := WalkForwardResult{Windows: []WalkForwardWindow{}}
+	stitched := Simulation{
+		Interval:      asset.Interval,
+		InitialEquity: options.Sweep.Simulator.InitialEquity,
+		Trades:        []Trade{},
+		Equity:        []EquityPoint{},
+	}
+	equity := stitched.InitialEquity
+	var errs []error
+
+	// the windows done so far are summed up even when a later one fails
+	finish := func(err error) (WalkForwardResult, error) {
+		result.Simulation = stitched
+		result.Report = NewReport(stitched)
+		result.Stability = stability(result.Windows)
+		return result, err
+	}
+
+	for split := options.InSample; split < asset.Len(); split += options.OutOfSample {
+		start := split - options.InSample
+		if options.Anchored {
+			start = 0
+		}
+		end := min(split+options.OutOfSample, asset.Len())
+
+		results, err := Sweep(ctx, symbol, asset.Slice(start, split), options.Candidates, options.Sweep)
+		if ctx.Err() != nil {
+			return finish(ctx.Err())
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("window from %v: %w", asset.Date[start], err))
+		}
+		if len(results) == 0 {
+			return finish(errors.Join(errs...))
+		}
+		RankSweep(results, options.Metric)
+		best := results[0]
+
+		simulation, err := outOfSample(symbol, asset.Slice(start, end), split-start, best.Params, options.Sweep, equity)
+		if err != nil {
+			return finish(errors.Join(append(errs, fmt.Errorf("window from %v: %w", asset.Date[start], err))...))
+		}
+		for _, trade := range simulation.Trades {
+			trade.EntryIndex += start
+			trade.ExitIndex += start
+			trade.Divergence.Shift(start)
+			stitched.Trades = append(stitched.Trades, trade)
+		}
+		stitched.Equity = append(stitched.Equity, simulation.Equity...)
+		stitched.Skipped += simulation.Skipped
+		equity = simulation.Equity[len(simulation.Equity)-1].Equity
+
+		result.Windows = append(result.Windows, WalkForwardWindow{
+			InSampleStart:    asset.Date[start],
+			OutOfSampleStart: asset.Date[split],
+			OutOfSampleEnd:   asset.Date[end-1],
+			Params:           best.Params,
+			InSample:         best.Report,
+			OutOfSample:      NewReport(simulation),
+		})
+	}
+
+	return finish(errors.Join(errs...))
+}
+
+// outOfSample trades params on the bars of asset from split on, with the bars before it as history
+func outOfSample(symbol string, asset models.Asset, split int, params Params, options SweepOptions, equity float64) (Simulation, error) {
+	divergences, err := options.detect(asset, params)
+	if err != nil {
+		return Simulation{}, err
+	}
+	traded := []divergence_detection.Divergence{}
+	for _, divergence := range divergences {
+		if divergence.ConfirmationIndex >= split {
+			traded = append(traded, divergence)
+		}
+	}
+
+	config := options.Simulator
+	config.InitialEquity = equity
+	simulation, err := Simulate(symbol, asset, traded, config)
+	if err != nil {
+		return Simulation{}, err
+	}
+	// nothing is traded before the split, so the equity only starts there
+	simulation.Equity = simulation.Equity[split:]
+	return simulation, nil
+}
+
+// stability describes the params chosen by the windows
+func stability(windows []WalkForwardWindow) []ParamStability {
+	fields := []struct {
+		name  string
+		value func(Params) int
+	}{
+		{"order", func(p Params) int { return p.Order }},
+		{"k", func(p Params) int { return p.ChainLength }},
+		{"period", func(p Params) int { return p.Period }},
+		{"tolerance", func(p Params) int { return p.AlignmentTolerance }},
+		{"lookback", func(p Params) int { return p.Lookback }},
+	}
+
+	stabilities := []ParamStability{}
+	for _, field := range fields {
+		s := ParamStability{Name: field.name, Values: make([]int, len(windows))}
+		if len(windows) == 0 {
+			stabilities = append(stabilities, s)
+			continue
+		}
+
+		values := make([]float64, len(windows))
+		counts := make(map[int]int)
+		for i, window := range windows {
+			value := field.value(window.Params)
+			s.Values[i] = value
+			values[i] = float64(value)
+			counts[value]++
+			if i == 0 {
+				s.Min, s.Max = value, value
+				continue
+			}
+			s.Min, s.Max = min(s.Min, value), max(s.Max, value)
+			if value != s.Values[i-1] {
+				s.Changes++
+			}
+		}
+		for value, count := range counts {
+			if count > counts[s.Mode] || count == counts[s.Mode] && value < s.Mode {
+				s.Mode = value
+			}
+		}
+		s.ModeShare = float64(counts[s.Mode]) / float64(len(windows))
+		s.Mean = mean(values)
+		s.StdDev = stdDev(values)
+		stabilities = append(stabilities, s)
+	}
+	return stabilities
+}
+
+// WriteWalkForward writes the windows, the report of the stitched out-of-sample windows and the stability
+// of the params as aligned tables
+func WriteWalkForward(w io.Writer, result WalkForwardResult, metric string) error {
+	name := strings.ToUpper(metric)
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(table, "IN SAMPLE\tOUT OF SAMPLE\tORDER\tK\tPERIOD\tTOLERANCE\tLOOKBACK\tIS %s\tOOS %s\tOOS TRADES\tOOS RETURN\t\n", name, name)
+	for _, window := range result.Windows {
+		inSample, err := Metric(window.InSample, metric)
+		if err != nil {
+			return err
+		}
+		outOfSample, err := Metric(window.OutOfSample, metric)
+		if err != nil {
+			return err
+		}
+		p := window.Params
+		fmt.Fprintf(table, "%s\t%s - %s\t%d\t%d\t%d\t%d\t%d\t%.4g\t%.4g\t%d\t%.2f%%\t\n",
+			window.InSampleStart.UTC().Format("2006-01-02"),
+			window.OutOfSampleStart.UTC().Format("2006-01-02"), window.OutOfSampleEnd.UTC().Format("2006-01-02"),
+			p.Order, p.ChainLength, p.Period, p.AlignmentTolerance, p.Lookback,
+			inSample, outOfSample, window.OutOfSample.Total.Trades, 100*window.OutOfSample.TotalReturn)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "\nout of sample:")
+	if err := WriteReport(w, result.Report); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "\nparameter stability:")
+	table = tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "PARAM\tMIN\tMAX\tMEAN\tSTD DEV\tMODE\tMODE SHARE\tCHANGES\t")
+	for _, s := range result.Stability {
+		fmt.Fprintf(table, "%s\t%d\t%d\t%.2f\t%.2f\t%d\t%.0f%%\t%d\t\n",
+			s.Name, s.Min, s.Max, s.Mean, s.StdDev, s.Mode, 100*s.ModeShare, s.Changes)
+	}
+	return table.Flush()
+}
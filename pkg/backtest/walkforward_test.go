@@ -0,0 +1,164 @@
+package backtest
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func testWalkForwardOptions(inSample, outOfSample int, anchored bool) WalkForwardOptions {
+	return WalkForwardOptions{
+		Sweep:       testSweepOptions(),
+		Candidates:  Grid{Order: []int{3, 4}}.Params(Params{ChainLength: 2, Period: 14}),
+		Metric:      "return",
+		InSample:    inSample,
+		OutOfSample: outOfSample,
+		Anchored:    anchored,
+	}
+}
+
+func TestWalkForwardWindows(t *testing.T) {
+	asset := loadAsset(t)
+
+	tests := []struct {
+		name                  string
+		inSample, outOfSample int
+		anchored              bool
+		splits                []int
+	}{
+		{"rolling", 200, 100, false, []int{200, 300, 400}},
+		{"rolling with a short last window", 200, 120, false, []int{200, 320, 440}},
+		{"anchored", 250, 100, true, []int{250, 350, 450}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := WalkForward(context.Background(), "BTC", asset, testWalkForwardOptions(test.inSample, test.outOfSample, test.anchored))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Windows) != len(test.splits) {
+				t.Fatalf("got %d windows, want %d", len(result.Windows), len(test.splits))
+			}
+
+			for i, window := range result.Windows {
+				split := test.splits[i]
+				start := split - test.inSample
+				if test.anchored {
+					start = 0
+				}
+				end := min(split+test.outOfSample, asset.Len())
+				if !window.InSampleStart.Equal(asset.Date[start]) || !window.OutOfSampleStart.Equal(asset.Date[split]) || !window.OutOfSampleEnd.Equal(asset.Date[end-1]) {
+					t.Errorf("window %d is %v, %v - %v, want bars %d, %d - %d", i, window.InSampleStart, window.OutOfSampleStart, window.OutOfSampleEnd, start, split, end-1)
+				}
+				// the in-sample report only covers the bars before the split
+				if !window.InSample.End.Equal(asset.Date[split-1]) {
+					t.Errorf("window %d: in sample ends at %v, want %v", i, window.InSample.End, asset.Date[split-1])
+				}
+			}
+		})
+	}
+}
+
+func TestWalkForwardStitchesEquity(t *testing.T) {
+	asset := loadAsset(t)
+	options := testWalkForwardOptions(200, 100, false)
+
+	result, err := WalkForward(context.Background(), "BTC", asset, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	equity := result.Simulation.Equity
+	if len(equity) != asset.Len()-200 {
+		t.Fatalf("got %d equity points, want %d", len(equity), asset.Len()-200)
+	}
+	for i, point := range equity {
+		if !point.Time.Equal(asset.Date[200+i]) {
+			t.Fatalf("equity point %d at %v, want %v", i, point.Time, asset.Date[200+i])
+		}
+	}
+
+	initial := options.Sweep.Simulator.InitialEquity
+	for i, window := range result.Windows {
+		if window.OutOfSample.InitialEquity != initial {
+			t.Errorf("window %d starts with %v, want the %v the one before ended with", i, window.OutOfSample.InitialEquity, initial)
+		}
+		initial = window.OutOfSample.FinalEquity
+	}
+	if result.Report.FinalEquity != initial || equity[len(equity)-1].Equity != initial {
+		t.Errorf("the stitched equity ends at %v, want %v", result.Report.FinalEquity, initial)
+	}
+
+	if len(result.Simulation.Trades) == 0 {
+		t.Fatal("no trades")
+	}
+	for _, trade := range result.Simulation.Trades {
+		inWindow := false
+		for _, window := range result.Windows {
+			if !trade.EntryTime.Before(window.OutOfSampleStart) && !trade.ExitTime.After(window.OutOfSampleEnd) {
+				inWindow = true
+			}
+		}
+		if !inWindow || !asset.Date[trade.EntryIndex].Equal(trade.EntryTime) || trade.Divergence.ConfirmationIndex < 200 {
+			t.Errorf("trade from %v to %v, confirmed on bar %d, is not within one out-of-sample window", trade.EntryTime, trade.ExitTime, trade.Divergence.ConfirmationIndex)
+		}
+	}
+}
+
+func TestWalkForwardKeepsCompletedWindows(t *testing.T) {
+	asset := loadAsset(t)
+	// the open prices end after bar 400, so the window trading bars 400 to 500 cannot be simulated
+	asset.Opening = asset.Opening[:400]
+
+	result, err := WalkForward(context.Background(), "BTC", asset, testWalkForwardOptions(200, 100, false))
+	if err == nil {
+		t.Fatal("no error")
+	}
+	if len(result.Windows) != 2 {
+		t.Fatalf("got %d windows, want the 2 before the failure", len(result.Windows))
+	}
+
+	equity := result.Simulation.Equity
+	if len(equity) != 200 {
+		t.Fatalf("got %d equity points, want 200", len(equity))
+	}
+	if result.Report.FinalEquity != equity[len(equity)-1].Equity || result.Report.FinalEquity != result.Windows[1].OutOfSample.FinalEquity {
+		t.Errorf("report ends at %v, want %v", result.Report.FinalEquity, equity[len(equity)-1].Equity)
+	}
+	if len(result.Stability) != 5 || len(result.Stability[0].Values) != 2 {
+		t.Errorf("got stability %+v, want 5 params over 2 windows", result.Stability)
+	}
+}
+
+func TestStability(t *testing.T) {
+	orders := []int{3, 4, 4, 5, 3}
+	windows := make([]WalkForwardWindow, len(orders))
+	for i, order := range orders {
+		windows[i].Params = Params{Order: order, ChainLength: 2}
+	}
+
+	stabilities := stability(windows)
+	if len(stabilities) != 5 {
+		t.Fatalf("got %d params, want 5", len(stabilities))
+	}
+	order, k := stabilities[0], stabilities[1]
+
+	// 3 and 4 are both chosen twice, the smaller one is the mode
+	want := ParamStability{Name: "order", Values: orders, Min: 3, Max: 5, Mean: 3.8, Mode: 3, ModeShare: 0.4, Changes: 3}
+	want.StdDev = math.Sqrt((0.64 + 0.04 + 0.04 + 1.44 + 0.64) / 4)
+	if math.Abs(order.StdDev-want.StdDev) > 1e-9 || math.Abs(order.Mean-want.Mean) > 1e-9 {
+		t.Errorf("mean %v and std dev %v, want %v and %v", order.Mean, order.StdDev, want.Mean, want.StdDev)
+	}
+	order.Mean, order.StdDev = want.Mean, want.StdDev
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("got %+v, want %+v", order, want)
+	}
+	if k.Min != 2 || k.Max != 2 || k.StdDev != 0 || k.ModeShare != 1 || k.Changes != 0 {
+		t.Errorf("a param that never changed got %+v", k)
+	}
+
+	if empty := stability(nil); len(empty) != 5 || len(empty[0].Values) != 0 {
+		t.Errorf("no windows got %+v", empty)
+	}
+}
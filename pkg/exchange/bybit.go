@@ -0,0 +1,178 @@
+package exchange
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/divergence/pkg/feed"
+	"github.com/divergence/pkg/models"
+)
+
+const BybitURL = "https://api.bybit.com"
+
+// bybitRateLimited is the return code of a request that exceeded the rate limit
+const bybitRateLimited = 10006
+
+// BybitClient downloads candles from the Bybit v5 kline endpoint
+type BybitClient struct {
+	BaseURL string
+	// Category is linear, inverse or spot
+	Category   string
+	HTTPClient *http.Client
+	// Limit is the number of candles per request, at most 1000
+	Limit int
+	// RateLimit is the minimum time between two requests
+	RateLimit time.Duration
+	Retry     RetryConfig
+
+	limiter rateLimiter
+}
+
+// NewBybitClient returns a client for linear perpetuals that stays well below the public rate limit
+func NewBybitClient() *BybitClient {
+	return &BybitClient{
+		BaseURL:    BybitURL,
+		Category:   "linear",
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		Limit:      1000,
+		RateLimit:  100 * time.Millisecond,
+		Retry:      RetryConfig{Attempts: 5, Backoff: 500 * time.Millisecond, MaxBackoff: 10 * time.Second},
+	}
+}
+
+func (c *BybitClient) Name() string { return "bybit" }
+
+// Candles pages backwards from to, because Bybit returns the newest candles of a range first
+func (c *BybitClient) Candles(ctx context.Context, symbol string, interval time.Duration, from, to time.Time) ([]*models.Candle, error) {
+	bybitInterval, err := toBybitInterval(interval)
+	if err != nil {
+		return nil, err
+	}
+	if c.Limit < 1 || c.Limit > 1000 {
+		return nil, fmt.Errorf("limit must be between 1 and 1000, got %d", c.Limit)
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("from %v is not before to %v", from, to)
+	}
+
+	byTime := make(map[int64]*models.Candle)
+	end := to.UnixMilli() - 1
+	for {
+		page, err := c.page(ctx, symbol, bybitInterval, from.UnixMilli(), end)
+		if err != nil {
+			return nil, err
+		}
+		for _, candle := range page {
+			byTime[candle.StartTime().UnixMilli()] = candle
+		}
+		if len(page) < c.Limit || !page[0].StartTime().After(from) {
+			break
+		}
+		end = page[0].StartTime().UnixMilli() - 1
+	}
+
+	candles := make([]*models.Candle, 0, len(byTime))
+	for _, candle := range byTime {
+		if t := candle.StartTime(); !t.Before(from) && t.Before(to) {
+			candles = append(candles, candle)
+		}
+	}
+	sort.Slice(candles, func(i, j int) bool { return candles[i].StartTime().Before(candles[j].StartTime()) })
+	models.SetInterval(candles, interval)
+	return candles, nil
+}
+
+// page requests the candles from start to end in milliseconds, both included, ordered from old to new
+func (c *BybitClient) page(ctx context.Context, symbol, interval string, start, end int64) ([]*models.Candle, error) {
+	query := url.Values{}
+	query.Set("category", c.Category)
+	query.Set("symbol", symbol)
+	query.Set("interval", interval)
+	query.Set("start", strconv.FormatInt(start, 10))
+	query.Set("end", strconv.FormatInt(end, 10))
+	query.Set("limit", strconv.Itoa(c.Limit))
+	address := c.BaseURL + "/v5/market/kline?" + query.Encode()
+
+	var candles []*models.Candle
+	err := retry(ctx, c.Retry, func() error {
+		if err := c.limiter.wait(ctx, c.RateLimit); err != nil {
+			return err
+		}
+		body, err := c.get(ctx, address)
+		if err != nil {
+			return err
+		}
+
+		var status struct {
+			RetCode int    `json:"retCode"`
+			RetMsg  string `json:"retMsg"`
+		}
+		if err := json.Unmarshal(body, &status); err == nil && status.RetCode == bybitRateLimited {
+			return temporaryError{fmt.Errorf("bybit error %d: %s", status.RetCode, status.RetMsg)}
+		}
+
+		candles, err = feed.BybitFormat{}.Decode(bytes.NewReader(body))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bybit %s %s: %w", symbol, interval, err)
+	}
+	return candles, nil
+}
+
+func (c *BybitClient) get(ctx context.Context, address string) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, temporaryError{err}
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, temporaryError{err}
+	}
+
+	if response.StatusCode != http.StatusOK {
+		err := fmt.Errorf("http status %d: %s", response.StatusCode, bytes.TrimSpace(body))
+		if response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500 {
+			return nil, temporaryError{err}
+		}
+		return nil, err
+	}
+	return body, nil
+}
+
+// toBybitInterval converts interval to the kline intervals Bybit supports
+func toBybitInterval(interval time.Duration) (string, error) {
+	switch {
+	case interval == models.Day:
+		return "D", nil
+	case interval == models.Week:
+		return "W", nil
+	case interval%time.Minute == 0:
+		minutes := int(interval / time.Minute)
+		switch minutes {
+		case 1, 3, 5, 15, 30, 60, 120, 240, 360, 720:
+			return strconv.Itoa(minutes), nil
+		}
+	}
+	return "", fmt.Errorf("bybit has no %s candles", models.FormatInterval(interval))
+}
@@ -0,0 +1,115 @@
+package exchange_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/divergence/pkg/exchange"
+	"github.com/divergence/pkg/exchange/exchangetest"
+)
+
+func newTestClient(url string, limit int) *exchange.BybitClient {
+	client := exchange.NewBybitClient()
+	client.BaseURL = url
+	client.Limit = limit
+	client.RateLimit = 0
+	client.Retry = exchange.RetryConfig{Attempts: 3, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	return client
+}
+
+func TestBybitPaging(t *testing.T) {
+	fake := exchangetest.NewBybit(exchangetest.Candles(25, 4*time.Hour))
+	defer fake.Close()
+	client := newTestClient(fake.URL, 10)
+
+	candles, err := client.Candles(context.Background(), "BTCUSDT", 4*time.Hour, exchangetest.Start, exchangetest.Start.Add(25*4*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candles) != 25 {
+		t.Fatalf("got %d candles, want 25", len(candles))
+	}
+	for i, candle := range candles {
+		if want := exchangetest.Start.Add(time.Duration(i) * 4 * time.Hour); !candle.StartTime().Equal(want) {
+			t.Fatalf("candle %d opens at %v, want %v", i, candle.StartTime(), want)
+		}
+		if candle.Interval != 4*time.Hour {
+			t.Fatalf("candle %d has interval %v", i, candle.Interval)
+		}
+	}
+	if fake.Requests() != 3 {
+		t.Errorf("made %d requests, want 3 pages of 10", fake.Requests())
+	}
+}
+
+func TestBybitRange(t *testing.T) {
+	fake := exchangetest.NewBybit(exchangetest.Candles(25, 4*time.Hour))
+	defer fake.Close()
+
+	tests := []struct {
+		name       string
+		from, to   int
+		first, len int
+	}{
+		{"middle", 5, 12, 5, 7},
+		{"before the first candle", -10, 3, 0, 3},
+		{"after the last candle", 20, 40, 20, 5},
+		{"page boundary", 3, 23, 3, 20},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newTestClient(fake.URL, 10)
+			from := exchangetest.Start.Add(time.Duration(test.from) * 4 * time.Hour)
+			to := exchangetest.Start.Add(time.Duration(test.to) * 4 * time.Hour)
+
+			candles, err := client.Candles(context.Background(), "BTCUSDT", 4*time.Hour, from, to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(candles) != test.len {
+				t.Fatalf("got %d candles, want %d", len(candles), test.len)
+			}
+			if want := exchangetest.Start.Add(time.Duration(test.first) * 4 * time.Hour); !candles[0].StartTime().Equal(want) {
+				t.Errorf("first candle opens at %v, want %v", candles[0].StartTime(), want)
+			}
+		})
+	}
+}
+
+func TestBybitRetry(t *testing.T) {
+	tests := []struct {
+		codes    []int
+		ok       bool
+		requests int
+	}{
+		{[]int{500}, true, 2},
+		{[]int{503, 502}, true, 3},
+		{[]int{429}, true, 2},
+		{[]int{10006, 10006}, true, 3},
+		{[]int{500, 500, 500}, false, 3},
+		{[]int{400}, false, 1},
+		{[]int{404}, false, 1},
+		{[]int{10001}, false, 1},
+	}
+	for _, test := range tests {
+		t.Run(strconv.Itoa(test.codes[0]), func(t *testing.T) {
+			fake := exchangetest.NewBybit(exchangetest.Candles(5, 4*time.Hour))
+			defer fake.Close()
+			fake.Fail(test.codes...)
+			client := newTestClient(fake.URL, 10)
+
+			candles, err := client.Candles(context.Background(), "BTCUSDT", 4*time.Hour, exchangetest.Start, exchangetest.Start.Add(5*4*time.Hour))
+			if test.ok && (err != nil || len(candles) != 5) {
+				t.Errorf("got %d candles and error %v, want 5 candles", len(candles), err)
+			}
+			if !test.ok && err == nil {
+				t.Error("no error")
+			}
+			if fake.Requests() != test.requests {
+				t.Errorf("made %d requests, want %d", fake.Requests(), test.requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/divergence/pkg/models"
+)
+
+// Client downloads candles from an exchange
+type Client interface {
+	Name() string
+	// Candles returns the candles of symbol that open from from up to, but not including, to, ordered from
+	// old to new. A zero to downloads up to now, including the candle that is still running
+	Candles(ctx context.Context, symbol string, interval time.Duration, from, to time.Time) ([]*models.Candle, error)
+}
+
+// RetryConfig tells a client how often to repeat a request that failed for a temporary reason
+type RetryConfig struct {
+	// Attempts is the number of requests made at most, 1 does not retry
+	Attempts int
+	// Backoff is the wait before the first retry, it doubles with every further retry up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// temporaryError marks a failed request that may succeed when it is repeated
+type temporaryError struct {
+	err error
+}
+
+func (e temporaryError) Error() string { return e.err.Error() }
+func (e temporaryError) Unwrap() error { return e.err }
+
+// retry calls f until it succeeds, fails with an error that is not temporary or the attempts are used up
+func retry(ctx context.Context, config RetryConfig, f func() error) error {
+	backoff := config.Backoff
+	for attempt := 1; ; attempt++ {
+		err := f()
+
+		var temporary temporaryError
+		if err == nil || !errors.As(err, &temporary) || attempt >= config.Attempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, config.MaxBackoff)
+	}
+}
+
+// rateLimiter spaces requests
+type rateLimiter struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+// wait blocks until every has passed since the previous request
+func (l *rateLimiter) wait(ctx context.Context, every time.Duration) error {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(every)
+	l.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Until(at)):
+		return nil
+	}
+}
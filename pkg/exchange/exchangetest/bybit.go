@@ -0,0 +1,122 @@
+// Package exchangetest fakes exchange APIs, so clients can be tested without a network
+package exchangetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/divergence/pkg/models"
+)
+
+// Bybit serves the Bybit v5 kline endpoint from candles in memory. Point BybitClient.BaseURL at URL
+type Bybit struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	candles  []*models.Candle
+	failures []int
+	requests int
+}
+
+// NewBybit starts a server that returns candles for every symbol and interval. Close it when done
+func NewBybit(candles []*models.Candle) *Bybit {
+	sorted := make([]*models.Candle, len(candles))
+	copy(sorted, candles)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].StartTime().Before(sorted[j].StartTime()) })
+
+	fake := &Bybit{candles: sorted}
+	fake.Server = httptest.NewServer(http.HandlerFunc(fake.serve))
+	return fake
+}
+
+// Fail makes the next requests fail, one per code. HTTP status codes are returned as the status, other
+// codes as the retCode of an otherwise successful response, like 10006 for exceeding the rate limit
+func (f *Bybit) Fail(codes ...int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = append(f.failures, codes...)
+}
+
+// Requests returns the number of requests served
+func (f *Bybit) Requests() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests
+}
+
+func (f *Bybit) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests++
+
+	if r.URL.Path != "/v5/market/kline" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if len(f.failures) > 0 {
+		code := f.failures[0]
+		f.failures = f.failures[1:]
+		if code < 10000 {
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+		writeBybit(w, code, "fake failure", nil)
+		return
+	}
+
+	query := r.URL.Query()
+	start, startErr := strconv.ParseInt(query.Get("start"), 10, 64)
+	end, endErr := strconv.ParseInt(query.Get("end"), 10, 64)
+	limit := 200
+	if query.Has("limit") {
+		limit, _ = strconv.Atoi(query.Get("limit"))
+	}
+	if query.Get("symbol") == "" || query.Get("interval") == "" || startErr != nil || endErr != nil || limit < 1 || limit > 1000 {
+		writeBybit(w, 10001, "params error", nil)
+		return
+	}
+
+	// the newest limit candles within start and end, newest first
+	list := [][]string{}
+	for i := len(f.candles) - 1; i >= 0 && len(list) < limit; i-- {
+		candle := f.candles[i]
+		t := candle.StartTime().UnixMilli()
+		if t < start || t > end {
+			continue
+		}
+		list = append(list, []string{
+			candle.OpenTime,
+			strconv.FormatFloat(candle.Open, 'f', -1, 64),
+			strconv.FormatFloat(candle.High, 'f', -1, 64),
+			strconv.FormatFloat(candle.Low, 'f', -1, 64),
+			strconv.FormatFloat(candle.Close, 'f', -1, 64),
+			strconv.FormatFloat(candle.BaseVolume, 'f', -1, 64),
+			strconv.FormatFloat(candle.QuoteVolume, 'f', -1, 64),
+		})
+	}
+	writeBybit(w, 0, "OK", map[string]interface{}{
+		"symbol":   query.Get("symbol"),
+		"category": query.Get("category"),
+		"list":     list,
+	})
+}
+
+func writeBybit(w http.ResponseWriter, code int, message string, result interface{}) {
+	if result == nil {
+		result = map[string]interface{}{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"retCode":    code,
+		"retMsg":     message,
+		"result":     result,
+		"retExtInfo": map[string]interface{}{},
+		"time":       time.Now().UnixMilli(),
+	})
+}
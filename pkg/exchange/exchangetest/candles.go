@@ -0,0 +1,30 @@
+package exchangetest
+
+import (
+	"time"
+
+	"github.com/divergence/pkg/common"
+	"github.com/divergence/pkg/models"
+)
+
+// Start is the open time of the first candle returned by Candles
+var Start = time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)
+
+// Candles returns n candles of interval from Start. Candle i opens at 100+i, closes 1 higher and has a
+// volume of 10
+func Candles(n int, interval time.Duration) []*models.Candle {
+	candles := make([]*models.Candle, n)
+	for i := range candles {
+		open := Start.Add(time.Duration(i) * interval)
+		price := 100 + float64(i)
+		candles[i] = &models.Candle{
+			Open:       price,
+			High:       price + 2,
+			Low:        price - 1,
+			Close:      price + 1,
+			BaseVolume: 10,
+			OpenTime:   common.Int64ToString(open.UnixMilli()),
+		}
+	}
+	return candles
+}
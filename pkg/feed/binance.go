@@ -0,0 +1,63 @@
+package feed
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/divergence/pkg/models"
+)
+
+// BinanceFormat reads the arrays returned by the Binance klines endpoint:
+// [openTime, open, high, low, close, volume, closeTime, quoteVolume, trades, ...]
+type BinanceFormat struct{}
+
+func (BinanceFormat) Decode(r io.Reader) ([]*models.Candle, error) {
+	var rows [][]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("decoding binance klines: %w", err)
+	}
+
+	candles := make([]*models.Candle, 0, len(rows))
+	for i, row := range rows {
+		if len(row) < 8 {
+			return nil, fmt.Errorf("binance kline %d: expected at least 8 fields, got %d", i, len(row))
+		}
+
+		raw := ohlcv{
+			openTime:    rawString(row[0]),
+			open:        rawString(row[1]),
+			high:        rawString(row[2]),
+			low:         rawString(row[3]),
+			close:       rawString(row[4]),
+			volume:      rawString(row[5]),
+			quoteVolume: rawString(row[7]),
+		}
+		candle, err := raw.candle()
+		if err != nil {
+			return nil, fmt.Errorf("binance kline %d: %w", i, err)
+		}
+
+		// binance closes a candle on the last millisecond before the next one opens
+		closeTime, err := parseMillis("close time", rawString(row[6]))
+		if err != nil {
+			return nil, fmt.Errorf("binance kline %d: %w", i, err)
+		}
+		candle.SetInterval(time.UnixMilli(closeTime + 1).Sub(candle.StartTime()))
+
+		candles = append(candles, candle)
+	}
+
+	return sortCandles(candles), nil
+}
+
+// rawString returns JSON numbers and strings without quotes
+func rawString(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return strings.TrimSpace(string(raw))
+}
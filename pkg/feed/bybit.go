@@ -0,0 +1,71 @@
+package feed
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/divergence/pkg/models"
+)
+
+// BybitFormat reads the response of the Bybit v5 kline endpoint. Both the full response and only its
+// result object, as stored in data/btc-4h.json, are accepted
+type BybitFormat struct {
+	// Symbol and Category are written by Encode, Decode ignores them
+	Symbol   string
+	Category string
+}
+
+type bybitResult struct {
+	Symbol   string     `json:"symbol,omitempty"`
+	Category string     `json:"category,omitempty"`
+	List     [][]string `json:"list"`
+}
+
+type bybitResponse struct {
+	RetCode *int         `json:"retCode"`
+	RetMsg  string       `json:"retMsg"`
+	Result  *bybitResult `json:"result"`
+	bybitResult
+}
+
+func (BybitFormat) Decode(r io.Reader) ([]*models.Candle, error) {
+	var response bybitResponse
+	if err := json.NewDecoder(r).Decode(&response); err != nil {
+		return nil, fmt.Errorf("decoding bybit klines: %w", err)
+	}
+
+	if response.RetCode != nil && *response.RetCode != 0 {
+		return nil, fmt.Errorf("bybit error %d: %s", *response.RetCode, response.RetMsg)
+	}
+
+	list := response.List
+	if response.Result != nil {
+		list = response.Result.List
+	}
+
+	return decodeBybitList(list)
+}
+
+// decodeBybitList parses rows of [startTime, open, high, low, close, volume, turnover]
+func decodeBybitList(list [][]string) ([]*models.Candle, error) {
+	candles := make([]*models.Candle, 0, len(list))
+	for i, row := range list {
+		if len(row) < 6 {
+			return nil, fmt.Errorf("bybit kline %d: expected at least 6 fields, got %d", i, len(row))
+		}
+
+		raw := ohlcv{openTime: row[0], open: row[1], high: row[2], low: row[3], close: row[4], volume: row[5]}
+		if len(row) > 6 {
+			raw.quoteVolume = row[6]
+		}
+
+		candle, err := raw.candle()
+		if err != nil {
+			return nil, fmt.Errorf("bybit kline %d: %w", i, err)
+		}
+		candles = append(candles, candle)
+	}
+
+	return sortCandles(candles), nil
+}
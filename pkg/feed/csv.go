@@ -0,0 +1,155 @@
+package feed
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/divergence/pkg/models"
+)
+
+// Timestamp formats of CSVFormat besides time layouts
+const (
+	UnixSeconds = "unix"
+	UnixMillis  = "unixms"
+)
+
+// CSVColumns holds the zero based position of every field. The fields after Volume are optional, they are
+// -1 when the format has no such column and 0 in rows that end before it or leave it empty
+type CSVColumns struct {
+	Time         int
+	Open         int
+	High         int
+	Low          int
+	Close        int
+	Volume       int
+	QuoteVolume  int
+	OpenInterest int
+	FundingRate  int
+}
+
+// CSVFormat reads one candle per row
+type CSVFormat struct {
+	Columns CSVColumns
+	// TimeFormat is UnixSeconds, UnixMillis or a layout for time.Parse
+	TimeFormat string
+	// Location is used for layouts without a timezone. nil uses UTC
+	Location *time.Location
+	// Comma is the field separator, 0 uses ','
+	Comma rune
+	// Header skips the first row
+	Header bool
+}
+
+// DefaultCSVFormat reads time,open,high,low,close,volume,quoteVolume,openInterest,fundingRate with a header
+// and timestamps in milliseconds
+func DefaultCSVFormat() CSVFormat {
+	return CSVFormat{
+		Columns:    CSVColumns{Time: 0, Open: 1, High: 2, Low: 3, Close: 4, Volume: 5, QuoteVolume: 6, OpenInterest: 7, FundingRate: 8},
+		TimeFormat: UnixMillis,
+		Header:     true,
+	}
+}
+
+func (f CSVFormat) Decode(r io.Reader) ([]*models.Candle, error) {
+	reader := csv.NewReader(r)
+	if f.Comma != 0 {
+		reader.Comma = f.Comma
+	}
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	columns := f.Columns
+	required := []int{columns.Time, columns.Open, columns.High, columns.Low, columns.Close, columns.Volume}
+	last := 0
+	for _, column := range required {
+		if column < 0 {
+			return nil, errors.New("csv: time, open, high, low, close and volume columns are required")
+		}
+		last = max(last, column)
+	}
+
+	candles := []*models.Candle{}
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("csv: %w", err)
+		}
+		if row == 1 && f.Header {
+			continue
+		}
+		if len(record) <= last {
+			return nil, fmt.Errorf("csv row %d: expected at least %d fields, got %d", row, last+1, len(record))
+		}
+
+		openTime, err := f.parseTime(record[columns.Time])
+		if err != nil {
+			return nil, fmt.Errorf("csv row %d: %w", row, err)
+		}
+
+		raw := ohlcv{
+			openTime: strconv.FormatInt(openTime.UnixMilli(), 10),
+			open:     record[columns.Open],
+			high:     record[columns.High],
+			low:      record[columns.Low],
+			close:    record[columns.Close],
+			volume:   record[columns.Volume],
+		}
+		optional := func(column int) string {
+			if column < 0 || column >= len(record) {
+				return ""
+			}
+			return record[column]
+		}
+		raw.quoteVolume = optional(columns.QuoteVolume)
+		raw.openInterest = optional(columns.OpenInterest)
+		raw.fundingRate = optional(columns.FundingRate)
+
+		candle, err := raw.candle()
+		if err != nil {
+			return nil, fmt.Errorf("csv row %d: %w", row, err)
+		}
+		candles = append(candles, candle)
+	}
+
+	return sortCandles(candles), nil
+}
+
+func (f CSVFormat) parseTime(value string) (time.Time, error) {
+	return parseTime(f.TimeFormat, f.Location, value)
+}
+
+// parseTime reads value in format, which is UnixSeconds, UnixMillis or a layout for time.Parse
+func parseTime(format string, location *time.Location, value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	switch format {
+	case UnixSeconds, UnixMillis:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
+		}
+		if format == UnixSeconds {
+			return time.Unix(n, 0), nil
+		}
+		return time.UnixMilli(n), nil
+	case "":
+		return time.Time{}, errors.New("no time format set")
+	}
+
+	if location == nil {
+		location = time.UTC
+	}
+	t, err := time.ParseInLocation(format, value, location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: %w", value, err)
+	}
+	return t, nil
+}
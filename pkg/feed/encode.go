@@ -0,0 +1,181 @@
+package feed
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/divergence/pkg/models"
+)
+
+// Encoder writes candles in a format the matching Format reads back
+type Encoder interface {
+	Encode(w io.Writer, candles []*models.Candle) error
+}
+
+// WriteFile writes candles to path with encoder. The file is replaced at once, so readers never see half of it
+func WriteFile(path string, encoder Encoder, candles []*models.Candle) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	writer := bufio.NewWriter(temp)
+	if err := encoder.Encode(writer, candles); err != nil {
+		temp.Close()
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := writer.Flush(); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+// Encode writes the result object of a kline response, newest candle first like the exchange returns them
+func (f BybitFormat) Encode(w io.Writer, candles []*models.Candle) error {
+	result := bybitResult{Symbol: f.Symbol, Category: f.Category, List: make([][]string, 0, len(candles))}
+	for i := len(candles) - 1; i >= 0; i-- {
+		candle := candles[i]
+		result.List = append(result.List, []string{
+			candle.OpenTime,
+			formatFloat(candle.Open),
+			formatFloat(candle.High),
+			formatFloat(candle.Low),
+			formatFloat(candle.Close),
+			formatFloat(candle.BaseVolume),
+			formatFloat(candle.QuoteVolume),
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
+
+// Encode writes one object per candle with all fields NDJSONFormat reads. The open interest and the
+// funding rate are left out while they are unknown
+func (NDJSONFormat) Encode(w io.Writer, candles []*models.Candle) error {
+	encoder := json.NewEncoder(w)
+	for _, candle := range candles {
+		fields := map[string]json.Number{
+			"openTime":    json.Number(candle.OpenTime),
+			"open":        json.Number(formatFloat(candle.Open)),
+			"high":        json.Number(formatFloat(candle.High)),
+			"low":         json.Number(formatFloat(candle.Low)),
+			"close":       json.Number(formatFloat(candle.Close)),
+			"volume":      json.Number(formatFloat(candle.BaseVolume)),
+			"quoteVolume": json.Number(formatFloat(candle.QuoteVolume)),
+		}
+		if candle.OpenInterest != 0 {
+			fields["openInterest"] = json.Number(formatFloat(candle.OpenInterest))
+		}
+		if candle.FundingRate != 0 {
+			fields["fundingRate"] = json.Number(formatFloat(candle.FundingRate))
+		}
+		if err := encoder.Encode(fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Encode writes one row per candle at the positions of f.Columns. The open interest and the funding rate
+// are left empty while they are unknown
+func (f CSVFormat) Encode(w io.Writer, candles []*models.Candle) error {
+	if f.TimeFormat == "" {
+		return errors.New("csv: no time format set")
+	}
+
+	columns := f.Columns
+	fields := []struct {
+		column int
+		name   string
+		value  func(candle *models.Candle) string
+	}{
+		{columns.Time, "time", func(candle *models.Candle) string { return f.formatTime(candle.StartTime()) }},
+		{columns.Open, "open", func(candle *models.Candle) string { return formatFloat(candle.Open) }},
+		{columns.High, "high", func(candle *models.Candle) string { return formatFloat(candle.High) }},
+		{columns.Low, "low", func(candle *models.Candle) string { return formatFloat(candle.Low) }},
+		{columns.Close, "close", func(candle *models.Candle) string { return formatFloat(candle.Close) }},
+		{columns.Volume, "volume", func(candle *models.Candle) string { return formatFloat(candle.BaseVolume) }},
+		{columns.QuoteVolume, "quoteVolume", func(candle *models.Candle) string { return formatFloat(candle.QuoteVolume) }},
+		{columns.OpenInterest, "openInterest", func(candle *models.Candle) string { return formatUnknown(candle.OpenInterest) }},
+		{columns.FundingRate, "fundingRate", func(candle *models.Candle) string { return formatUnknown(candle.FundingRate) }},
+	}
+
+	width := 0
+	for _, field := range fields {
+		width = max(width, field.column+1)
+	}
+
+	writer := csv.NewWriter(w)
+	if f.Comma != 0 {
+		writer.Comma = f.Comma
+	}
+
+	if f.Header {
+		header := make([]string, width)
+		for _, field := range fields {
+			if field.column >= 0 {
+				header[field.column] = field.name
+			}
+		}
+		if err := writer.Write(header); err != nil {
+			return err
+		}
+	}
+
+	for _, candle := range candles {
+		record := make([]string, width)
+		for _, field := range fields {
+			if field.column >= 0 {
+				record[field.column] = field.value(candle)
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func (f CSVFormat) formatTime(t time.Time) string {
+	switch f.TimeFormat {
+	case UnixSeconds:
+		return strconv.FormatInt(t.Unix(), 10)
+	case UnixMillis:
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	}
+
+	location := f.Location
+	if location == nil {
+		location = time.UTC
+	}
+	return t.In(location).Format(f.TimeFormat)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// formatUnknown formats value like formatFloat, but leaves 0 empty
+func formatUnknown(value float64) string {
+	if value == 0 {
+		return ""
+	}
+	return formatFloat(value)
+}
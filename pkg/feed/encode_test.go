@@ -0,0 +1,105 @@
+package feed
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/divergence/pkg/common"
+	"github.com/divergence/pkg/models"
+)
+
+// testCandles returns hourly candles, the second one without open interest and funding rate
+func testCandles() []*models.Candle {
+	candles := []*models.Candle{}
+	for i, b := range bars {
+		candle := &models.Candle{
+			Open:         b.open,
+			High:         b.high,
+			Low:          b.low,
+			Close:        b.close,
+			BaseVolume:   b.volume,
+			QuoteVolume:  b.quote,
+			OpenTime:     common.Int64ToString(millis(b.hour)),
+			OpenInterest: 5000 + float64(i),
+			FundingRate:  -0.0001 * float64(i+1),
+		}
+		if i == 1 {
+			candle.OpenInterest, candle.FundingRate = 0, 0
+		}
+		candle.SetInterval(time.Hour)
+		candles = append(candles, candle)
+	}
+	return candles
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	seconds := DefaultCSVFormat()
+	seconds.TimeFormat, seconds.Comma = UnixSeconds, ';'
+	rfc3339 := DefaultCSVFormat()
+	rfc3339.TimeFormat, rfc3339.Header = time.RFC3339, false
+
+	tests := []struct {
+		name   string
+		format interface {
+			Format
+			Encoder
+		}
+		// the bybit kline format has no fields for the open interest and the funding rate
+		metrics bool
+	}{
+		{"bybit", BybitFormat{Symbol: "BTCUSDT", Category: "linear"}, false},
+		{"ndjson", NDJSONFormat{}, true},
+		{"csv", DefaultCSVFormat(), true},
+		{"csv in seconds", seconds, true},
+		{"csv in rfc3339", rfc3339, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			want := testCandles()
+			if !test.metrics {
+				for _, candle := range want {
+					candle.OpenInterest, candle.FundingRate = 0, 0
+				}
+			}
+
+			var buffer bytes.Buffer
+			if err := test.format.Encode(&buffer, testCandles()); err != nil {
+				t.Fatal(err)
+			}
+			candles, err := ReaderSource{Reader: &buffer, Format: test.format}.Candles()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(candles, want) {
+				for i := range candles {
+					t.Errorf("candle %d is %+v, want %+v", i, *candles[i], *want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "btc-1h.ndjson")
+	if err := WriteFile(path, NDJSONFormat{}, testCandles()); err != nil {
+		t.Fatal(err)
+	}
+	// writing again replaces the file
+	if err := WriteFile(path, NDJSONFormat{}, testCandles()[:2]); err != nil {
+		t.Fatal(err)
+	}
+
+	candles, err := FileSource{Path: path, Format: NDJSONFormat{}}.Candles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := testCandles()[:2]; !reflect.DeepEqual(candles, want) {
+		t.Errorf("got %d candles, want %d", len(candles), len(want))
+	}
+	if matches, _ := filepath.Glob(path + ".*"); len(matches) != 0 {
+		t.Errorf("temporary files are left: %v", matches)
+	}
+}
@@ -0,0 +1,174 @@
+package feed
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/divergence/pkg/models"
+)
+
+// CandleSource returns candles ordered from old to new
+type CandleSource interface {
+	Candles() ([]*models.Candle, error)
+}
+
+// Format decodes candles from a stream
+type Format interface {
+	Decode(r io.Reader) ([]*models.Candle, error)
+}
+
+// FileSource reads the candles of a file in the given format
+type FileSource struct {
+	Path   string
+	Format Format
+	// Interval is the length of the candles. 0 infers it from the gaps between them
+	Interval time.Duration
+}
+
+func (s FileSource) Candles() ([]*models.Candle, error) {
+	file, err := os.Open(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	candles, err := s.Format.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.Path, err)
+	}
+	models.SetInterval(candles, s.Interval)
+	return candles, nil
+}
+
+// ReaderSource reads the candles of a stream in the given format
+type ReaderSource struct {
+	Reader io.Reader
+	Format Format
+	// Interval is the length of the candles. 0 infers it from the gaps between them
+	Interval time.Duration
+}
+
+func (s ReaderSource) Candles() ([]*models.Candle, error) {
+	candles, err := s.Format.Decode(s.Reader)
+	if err != nil {
+		return nil, err
+	}
+	models.SetInterval(candles, s.Interval)
+	return candles, nil
+}
+
+// FormatByName returns the format called bybit, binance, ndjson or csv. csv is DefaultCSVFormat
+func FormatByName(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "bybit":
+		return BybitFormat{}, nil
+	case "binance":
+		return BinanceFormat{}, nil
+	case "ndjson":
+		return NDJSONFormat{}, nil
+	case "csv":
+		return DefaultCSVFormat(), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", name)
+	}
+}
+
+// FormatOf guesses the format from the extension of path. JSON files are taken for Bybit responses
+func FormatOf(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return BybitFormat{}, nil
+	case ".ndjson", ".jsonl":
+		return NDJSONFormat{}, nil
+	case ".csv":
+		return DefaultCSVFormat(), nil
+	default:
+		return nil, fmt.Errorf("%s: cannot tell the format from the extension", path)
+	}
+}
+
+// sortCandles orders candles from old to new, exchanges often return the newest candle first
+func sortCandles(candles []*models.Candle) []*models.Candle {
+	sort.SliceStable(candles, func(i, j int) bool {
+		return candles[i].StartTime().Before(candles[j].StartTime())
+	})
+	return candles
+}
+
+func parseFloat(field, value string) (float64, error) {
+	if value == "" {
+		return 0, fmt.Errorf("missing %s", field)
+	}
+	float, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", field, value)
+	}
+	return float, nil
+}
+
+func parseMillis(field, value string) (int64, error) {
+	if value == "" {
+		return 0, fmt.Errorf("missing %s", field)
+	}
+	millis, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", field, value)
+	}
+	return millis, nil
+}
+
+// ohlcv holds the raw fields of a candle before they are parsed
+type ohlcv struct {
+	openTime    string
+	open        string
+	high        string
+	low         string
+	close       string
+	volume      string
+	quoteVolume string
+	// openInterest and fundingRate are only written by the encoders of this package
+	openInterest string
+	fundingRate  string
+}
+
+func (o ohlcv) candle() (*models.Candle, error) {
+	openTime, err := parseMillis("open time", o.openTime)
+	if err != nil {
+		return nil, err
+	}
+
+	candle := &models.Candle{OpenTime: strconv.FormatInt(openTime, 10)}
+	fields := []struct {
+		name     string
+		value    string
+		to       *float64
+		optional bool
+	}{
+		{"open", o.open, &candle.Open, false},
+		{"high", o.high, &candle.High, false},
+		{"low", o.low, &candle.Low, false},
+		{"close", o.close, &candle.Close, false},
+		{"volume", o.volume, &candle.BaseVolume, false},
+		// the quote volume is not available in every format
+		{"quote volume", o.quoteVolume, &candle.QuoteVolume, true},
+		{"open interest", o.openInterest, &candle.OpenInterest, true},
+		{"funding rate", o.fundingRate, &candle.FundingRate, true},
+	}
+	for _, field := range fields {
+		if field.optional && field.value == "" {
+			continue
+		}
+		if *field.to, err = parseFloat(field.name, field.value); err != nil {
+			return nil, err
+		}
+	}
+
+	// most formats do not tell the interval, the close time is set by the source once it is known
+	return candle, nil
+}
@@ -0,0 +1,342 @@
+package feed
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/divergence/pkg/models"
+)
+
+var start = time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)
+
+// bar is the open time in hours after start and the prices and volumes a fixture should decode to
+type bar struct {
+	hour                                  int
+	open, high, low, close, volume, quote float64
+}
+
+var bars = []bar{
+	{0, 100, 102, 99, 101, 10, 1000},
+	{1, 101, 103, 100, 102.5, 12, 1230},
+	{2, 102.5, 104, 101, 103, 8, 820},
+}
+
+func checkCandles(t *testing.T, candles []*models.Candle, want []bar) {
+	t.Helper()
+	if len(candles) != len(want) {
+		t.Fatalf("got %d candles, want %d", len(candles), len(want))
+	}
+	for i, w := range want {
+		c := candles[i]
+		if open := start.Add(time.Duration(w.hour) * time.Hour); !c.StartTime().Equal(open) {
+			t.Errorf("candle %d opens at %v, want %v", i, c.StartTime().UTC(), open)
+		}
+		got := bar{w.hour, c.Open, c.High, c.Low, c.Close, c.BaseVolume, c.QuoteVolume}
+		if got != w {
+			t.Errorf("candle %d is %v, want %v", i, got, w)
+		}
+	}
+}
+
+func millis(hour int) int64 {
+	return start.Add(time.Duration(hour) * time.Hour).UnixMilli()
+}
+
+// bybitRows returns the rows of bars newest first, like the exchange
+func bybitRows() string {
+	rows := []string{}
+	for i := len(bars) - 1; i >= 0; i-- {
+		b := bars[i]
+		rows = append(rows, fmt.Sprintf(`["%d","%v","%v","%v","%v","%v","%v"]`, millis(b.hour), b.open, b.high, b.low, b.close, b.volume, b.quote))
+	}
+	return strings.Join(rows, ",")
+}
+
+func TestBybitFormat(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{"full response", `{"retCode":0,"retMsg":"OK","result":{"symbol":"BTCUSDT","list":[` + bybitRows() + `]}}`, ""},
+		{"result object", `{"symbol":"BTCUSDT","category":"linear","list":[` + bybitRows() + `]}`, ""},
+		{"error response", `{"retCode":10001,"retMsg":"params error","result":{}}`, "bybit error 10001"},
+		{"short row", `{"list":[["1727740800000","100","102","99","101"]]}`, "expected at least 6 fields"},
+		{"bad price", `{"list":[["1727740800000","100","abc","99","101","10"]]}`, `invalid high "abc"`},
+		{"empty price", `{"list":[["1727740800000","100","102","","101","10"]]}`, "missing low"},
+		{"bad time", `{"list":[["yesterday","100","102","99","101","10"]]}`, "invalid open time"},
+		{"not json", `<html>`, "decoding bybit klines"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			candles, err := BybitFormat{}.Decode(strings.NewReader(test.input))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got %d candles and error %v, want %q", len(candles), err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkCandles(t, candles, bars)
+		})
+	}
+}
+
+func TestBinanceFormat(t *testing.T) {
+	rows := []string{}
+	for _, b := range bars {
+		// numbers and strings are both accepted, binance closes a candle a millisecond before the next opens
+		rows = append(rows, fmt.Sprintf(`[%d,"%v","%v","%v","%v","%v",%d,"%v",42,"0","0","0"]`,
+			millis(b.hour), b.open, b.high, b.low, b.close, b.volume, millis(b.hour+1)-1, b.quote))
+	}
+	candles, err := BinanceFormat{}.Decode(strings.NewReader("[" + strings.Join(rows, ",") + "]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCandles(t, candles, bars)
+	for i, candle := range candles {
+		if candle.Interval != time.Hour {
+			t.Errorf("candle %d has interval %v, want 1h", i, candle.Interval)
+		}
+	}
+
+	for _, input := range []string{
+		`[[1727740800000,"100","102","99","101","10",1727744399999]]`,
+		`[[1727740800000,"100","102","99","x","10",1727744399999,"1000"]]`,
+		`[[1727740800000,"100","102","99","101","10","soon","1000"]]`,
+		`{"code":-1121,"msg":"Invalid symbol."}`,
+	} {
+		if candles, err := (BinanceFormat{}).Decode(strings.NewReader(input)); err == nil {
+			t.Errorf("%s: got %d candles, want an error", input, len(candles))
+		}
+	}
+}
+
+func TestNDJSONFormat(t *testing.T) {
+	lines := []string{}
+	for i, b := range bars {
+		if i == 1 {
+			// values may be strings, empty lines are skipped
+			lines = append(lines, fmt.Sprintf(`{"openTime":"%d","open":"%v","high":"%v","low":"%v","close":"%v","volume":"%v","quoteVolume":"%v"}`,
+				millis(b.hour), b.open, b.high, b.low, b.close, b.volume, b.quote), "")
+			continue
+		}
+		lines = append(lines, fmt.Sprintf(`{"openTime":%d,"open":%v,"high":%v,"low":%v,"close":%v,"volume":%v,"quoteVolume":%v}`,
+			millis(b.hour), b.open, b.high, b.low, b.close, b.volume, b.quote))
+	}
+	candles, err := NDJSONFormat{}.Decode(strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCandles(t, candles, bars)
+
+	tests := []struct {
+		input, err string
+	}{
+		{`{"openTime":1727740800000,"open":100,"high":102,"low":99,"close":101}`, "line 1: missing volume"},
+		{"\n" + `{"openTime":1727740800000,"open":100,`, "ndjson line 2"},
+		{`{"openTime":1727740800000,"open":"one hundred","high":102,"low":99,"close":101,"volume":10}`, "invalid open"},
+	}
+	for _, test := range tests {
+		if candles, err := (NDJSONFormat{}).Decode(strings.NewReader(test.input)); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got %d candles and error %v, want %q", test.input, len(candles), err, test.err)
+		}
+	}
+}
+
+func TestCSVFormat(t *testing.T) {
+	rows := func(format func(hour int) string, header string, order func(b bar, time string) []string, comma string) string {
+		lines := []string{}
+		if header != "" {
+			lines = append(lines, header)
+		}
+		// the rows are out of order, they are sorted by time
+		for _, i := range []int{2, 0, 1} {
+			b := bars[i]
+			lines = append(lines, strings.Join(order(b, format(b.hour)), comma))
+		}
+		return strings.Join(lines, "\n")
+	}
+	standard := func(b bar, time string) []string {
+		return []string{time, fmt.Sprint(b.open), fmt.Sprint(b.high), fmt.Sprint(b.low), fmt.Sprint(b.close), fmt.Sprint(b.volume), fmt.Sprint(b.quote)}
+	}
+	formatMillis := func(hour int) string { return fmt.Sprint(millis(hour)) }
+
+	defaults := DefaultCSVFormat()
+	seconds := defaults
+	seconds.TimeFormat, seconds.Header = UnixSeconds, false
+	rfc3339 := defaults
+	rfc3339.TimeFormat = time.RFC3339
+	// a layout without a timezone is read in Location
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	local := defaults
+	local.TimeFormat, local.Location, local.Comma = "2006-01-02 15:04", newYork, ';'
+	// the columns can be in any order
+	reordered := CSVFormat{
+		Columns:    CSVColumns{Time: 6, Open: 0, High: 1, Low: 2, Close: 3, Volume: 4, QuoteVolume: 5, OpenInterest: -1, FundingRate: -1},
+		TimeFormat: UnixMillis,
+	}
+
+	tests := []struct {
+		name   string
+		format CSVFormat
+		input  string
+	}{
+		{"milliseconds", defaults, rows(formatMillis, "time,open,high,low,close,volume,quoteVolume", standard, ",")},
+		{"seconds without header", seconds, rows(func(hour int) string { return fmt.Sprint(millis(hour) / 1000) }, "", standard, ",")},
+		{"rfc3339", rfc3339, rows(func(hour int) string {
+			return start.Add(time.Duration(hour) * time.Hour).In(newYork).Format(time.RFC3339)
+		}, "time,open,high,low,close,volume,quoteVolume", standard, ",")},
+		{"layout in a location", local, rows(func(hour int) string {
+			return start.Add(time.Duration(hour) * time.Hour).In(newYork).Format("2006-01-02 15:04")
+		}, "time;open;high;low;close;volume;quoteVolume", standard, ";")},
+		{"reordered columns", reordered, rows(formatMillis, "", func(b bar, time string) []string {
+			return append(standard(b, time)[1:], time)
+		}, ",")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			candles, err := test.format.Decode(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkCandles(t, candles, bars)
+		})
+	}
+
+	// rows may end after the volume
+	candles, err := DefaultCSVFormat().Decode(strings.NewReader("time,open,high,low,close,volume\n1727740800000,100,102,99,101,10\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCandles(t, candles, []bar{{0, 100, 102, 99, 101, 10, 0}})
+}
+
+func TestCSVFormatErrors(t *testing.T) {
+	header := "time,open,high,low,close,volume\n"
+	missingTime := DefaultCSVFormat()
+	missingTime.Columns.Time = -1
+	noTimeFormat := DefaultCSVFormat()
+	noTimeFormat.TimeFormat = ""
+
+	tests := []struct {
+		name   string
+		format CSVFormat
+		input  string
+		err    string
+	}{
+		{"bad timestamp", DefaultCSVFormat(), header + "2024-10-01,100,102,99,101,10\n", `csv row 2: invalid timestamp "2024-10-01"`},
+		{"too few fields", DefaultCSVFormat(), header + "1727740800000,100,102,99,101\n", "csv row 2: expected at least 6 fields, got 5"},
+		{"bad price", DefaultCSVFormat(), header + "1727740800000,100,n/a,99,101,10\n", `csv row 2: invalid high "n/a"`},
+		{"empty volume", DefaultCSVFormat(), header + "1727740800000,100,102,99,101,\n", "csv row 2: missing volume"},
+		{"unterminated quote", DefaultCSVFormat(), header + "\"1727740800000,100,102,99,101,10\n", "csv:"},
+		{"bad layout", func() CSVFormat { f := DefaultCSVFormat(); f.TimeFormat = time.RFC3339; return f }(), header + "1727740800000,100,102,99,101,10\n", "invalid time"},
+		{"missing column", missingTime, header, "columns are required"},
+		{"no time format", noTimeFormat, header + "1727740800000,100,102,99,101,10\n", "no time format set"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			candles, err := test.format.Decode(strings.NewReader(test.input))
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got %d candles and error %v, want %q", len(candles), err, test.err)
+			}
+		})
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "btc-1h.csv")
+	input := "time,open,high,low,close,volume\n"
+	for _, b := range bars {
+		input += fmt.Sprintf("%d,%v,%v,%v,%v,%v\n", millis(b.hour), b.open, b.high, b.low, b.close, b.volume)
+	}
+	if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	format, err := FormatOf(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	candles, err := FileSource{Path: path, Format: format}.Candles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candles) != 3 || candles[0].Interval != time.Hour {
+		t.Errorf("got %d candles with an interval of %v, want 3 inferred to be 1h", len(candles), candles[0].Interval)
+	}
+	candles, err = FileSource{Path: path, Format: format, Interval: 4 * time.Hour}.Candles()
+	if err != nil || candles[0].Interval != 4*time.Hour {
+		t.Errorf("the interval of the source was not used: %v", err)
+	}
+
+	if _, err := (FileSource{Path: filepath.Join(dir, "missing.csv"), Format: format}).Candles(); !os.IsNotExist(err) {
+		t.Errorf("got error %v for a missing file", err)
+	}
+	if _, err := FormatOf("btc-1h.txt"); err == nil {
+		t.Error("no error for an unknown extension")
+	}
+	for _, name := range []string{"bybit", "Binance", "ndjson", "csv"} {
+		if _, err := FormatByName(name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if _, err := FormatByName("xml"); err == nil {
+		t.Error("no error for an unknown format")
+	}
+}
+
+func TestPointFormats(t *testing.T) {
+	want := []models.Point{{Time: start, Value: 1.5}, {Time: start.Add(time.Hour), Value: 2}}
+
+	tests := []struct {
+		name   string
+		format PointFormat
+		input  string
+	}{
+		{"bybit open interest", BybitOpenInterestFormat{},
+			fmt.Sprintf(`{"retCode":0,"result":{"list":[{"openInterest":"2","timestamp":"%d"},{"openInterest":"1.5","timestamp":"%d"}]}}`, millis(1), millis(0))},
+		{"bybit funding rate", BybitFundingFormat{},
+			fmt.Sprintf(`{"list":[{"fundingRate":"2","fundingRateTimestamp":"%d"},{"fundingRate":"1.5","fundingRateTimestamp":"%d"}]}`, millis(1), millis(0))},
+		{"csv", DefaultCSVPointFormat(), fmt.Sprintf("time,value\n%d,2\n%d,1.5\n", millis(1), millis(0))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			points, err := test.format.DecodePoints(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(points) != len(want) {
+				t.Fatalf("got %v, want %v", points, want)
+			}
+			for i := range want {
+				if !points[i].Time.Equal(want[i].Time) || points[i].Value != want[i].Value {
+					t.Errorf("got %v, want %v", points, want)
+				}
+			}
+		})
+	}
+
+	for _, input := range []string{
+		`{"retCode":10001,"retMsg":"params error"}`,
+		`{"list":[{"openInterest":"many","timestamp":"1727740800000"}]}`,
+		`{"list":[{"openInterest":"2"}]}`,
+	} {
+		if points, err := (BybitOpenInterestFormat{}).DecodePoints(strings.NewReader(input)); err == nil {
+			t.Errorf("%s: got %d points, want an error", input, len(points))
+		}
+	}
+	if points, err := DefaultCSVPointFormat().DecodePoints(strings.NewReader("time,value\n1727740800000\n")); err == nil {
+		t.Errorf("got %d points for a row without a value, want an error", len(points))
+	}
+}
@@ -0,0 +1,65 @@
+package feed
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/divergence/pkg/models"
+)
+
+// NDJSONFormat reads one JSON object per line with the fields openTime (milliseconds), open, high, low,
+// close, volume and optionally quoteVolume, openInterest and fundingRate. Values may be numbers or strings,
+// empty lines are skipped
+type NDJSONFormat struct{}
+
+func (NDJSONFormat) Decode(r io.Reader) ([]*models.Candle, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	candles := []*models.Candle{}
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(text), &fields); err != nil {
+			return nil, fmt.Errorf("ndjson line %d: %w", line, err)
+		}
+
+		raw := ohlcv{
+			openTime: rawField(fields, "openTime"),
+			open:     rawField(fields, "open"),
+			high:     rawField(fields, "high"),
+			low:      rawField(fields, "low"),
+			close:    rawField(fields, "close"),
+			volume:   rawField(fields, "volume"),
+			// quote volume, open interest and funding rate are optional
+			quoteVolume:  rawField(fields, "quoteVolume"),
+			openInterest: rawField(fields, "openInterest"),
+			fundingRate:  rawField(fields, "fundingRate"),
+		}
+		candle, err := raw.candle()
+		if err != nil {
+			return nil, fmt.Errorf("ndjson line %d: %w", line, err)
+		}
+		candles = append(candles, candle)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("ndjson: %w", err)
+	}
+
+	return sortCandles(candles), nil
+}
+
+func rawField(fields map[string]json.RawMessage, name string) string {
+	raw, ok := fields[name]
+	if !ok {
+		return ""
+	}
+	return rawString(raw)
+}
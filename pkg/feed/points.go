@@ -0,0 +1,176 @@
+package feed
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/divergence/pkg/models"
+)
+
+// PointSource returns the points of a series that is published separately from the candles, ordered from old to new
+type PointSource interface {
+	Points() ([]models.Point, error)
+}
+
+// PointFormat decodes points from a stream
+type PointFormat interface {
+	DecodePoints(r io.Reader) ([]models.Point, error)
+}
+
+// PointFileSource reads the points of a file in the given format
+type PointFileSource struct {
+	Path   string
+	Format PointFormat
+}
+
+func (s PointFileSource) Points() ([]models.Point, error) {
+	file, err := os.Open(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	points, err := s.Format.DecodePoints(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.Path, err)
+	}
+	return points, nil
+}
+
+// BybitOpenInterestFormat reads the response of the Bybit v5 open interest endpoint
+type BybitOpenInterestFormat struct{}
+
+func (BybitOpenInterestFormat) DecodePoints(r io.Reader) ([]models.Point, error) {
+	return decodeBybitPoints(r, "open interest", "timestamp", "openInterest")
+}
+
+// BybitFundingFormat reads the response of the Bybit v5 funding rate history endpoint
+type BybitFundingFormat struct{}
+
+func (BybitFundingFormat) DecodePoints(r io.Reader) ([]models.Point, error) {
+	return decodeBybitPoints(r, "funding rate", "fundingRateTimestamp", "fundingRate")
+}
+
+type bybitPointResult struct {
+	List []map[string]json.RawMessage `json:"list"`
+}
+
+type bybitPointResponse struct {
+	RetCode *int              `json:"retCode"`
+	RetMsg  string            `json:"retMsg"`
+	Result  *bybitPointResult `json:"result"`
+	bybitPointResult
+}
+
+// decodeBybitPoints reads the list of a full response or of only its result object, like BybitFormat
+func decodeBybitPoints(r io.Reader, name, timeField, valueField string) ([]models.Point, error) {
+	var response bybitPointResponse
+	if err := json.NewDecoder(r).Decode(&response); err != nil {
+		return nil, fmt.Errorf("decoding bybit %s: %w", name, err)
+	}
+
+	if response.RetCode != nil && *response.RetCode != 0 {
+		return nil, fmt.Errorf("bybit error %d: %s", *response.RetCode, response.RetMsg)
+	}
+
+	list := response.List
+	if response.Result != nil {
+		list = response.Result.List
+	}
+
+	points := make([]models.Point, 0, len(list))
+	for i, fields := range list {
+		point, err := parsePoint(rawField(fields, timeField), rawField(fields, valueField), valueField)
+		if err != nil {
+			return nil, fmt.Errorf("bybit %s %d: %w", name, i, err)
+		}
+		points = append(points, point)
+	}
+
+	return sortPoints(points), nil
+}
+
+// CSVPointFormat reads one point per row
+type CSVPointFormat struct {
+	TimeColumn  int
+	ValueColumn int
+	// TimeFormat is UnixSeconds, UnixMillis or a layout for time.Parse
+	TimeFormat string
+	// Location is used for layouts without a timezone. nil uses UTC
+	Location *time.Location
+	// Comma is the field separator, 0 uses ','
+	Comma rune
+	// Header skips the first row
+	Header bool
+}
+
+// DefaultCSVPointFormat reads time,value with a header and timestamps in milliseconds
+func DefaultCSVPointFormat() CSVPointFormat {
+	return CSVPointFormat{TimeColumn: 0, ValueColumn: 1, TimeFormat: UnixMillis, Header: true}
+}
+
+func (f CSVPointFormat) DecodePoints(r io.Reader) ([]models.Point, error) {
+	if f.TimeColumn < 0 || f.ValueColumn < 0 {
+		return nil, errors.New("csv: time and value columns are required")
+	}
+
+	reader := csv.NewReader(r)
+	if f.Comma != 0 {
+		reader.Comma = f.Comma
+	}
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	last := max(f.TimeColumn, f.ValueColumn)
+	points := []models.Point{}
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("csv: %w", err)
+		}
+		if row == 1 && f.Header {
+			continue
+		}
+		if len(record) <= last {
+			return nil, fmt.Errorf("csv row %d: expected at least %d fields, got %d", row, last+1, len(record))
+		}
+
+		t, err := parseTime(f.TimeFormat, f.Location, record[f.TimeColumn])
+		if err != nil {
+			return nil, fmt.Errorf("csv row %d: %w", row, err)
+		}
+		value, err := parseFloat("value", record[f.ValueColumn])
+		if err != nil {
+			return nil, fmt.Errorf("csv row %d: %w", row, err)
+		}
+		points = append(points, models.Point{Time: t, Value: value})
+	}
+
+	return sortPoints(points), nil
+}
+
+func parsePoint(timestamp, value, field string) (models.Point, error) {
+	millis, err := parseMillis("timestamp", timestamp)
+	if err != nil {
+		return models.Point{}, err
+	}
+	float, err := parseFloat(field, value)
+	if err != nil {
+		return models.Point{}, err
+	}
+	return models.Point{Time: time.UnixMilli(millis), Value: float}, nil
+}
+
+func sortPoints(points []models.Point) []models.Point {
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+	return points
+}
@@ -0,0 +1,233 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"github.com/divergence/pkg/common"
+)
+
+// Asset holds the candles of a symbol as one series per field. All series are ordered from old to new,
+// the oldest candle is at index 0 and the newest at Len() - 1. Functions in pkg/ta that expect the newest
+// candle first take NewestFirst of a series
+type Asset struct {
+	// Interval is the time between the candles, 0 when unknown
+	Interval     time.Duration
+	Date         []time.Time
+	Opening      []float64
+	Closing      []float64
+	High         []float64
+	Low          []float64
+	Volume       []float64
+	VolumeInt    []int64
+	QuoteVolume  []float64
+	Change       []float64
+	OpenInterest []float64
+	FundingRate  []float64
+}
+
+// AssetFromCandles builds an asset from candles ordered from old to new
+func AssetFromCandles(candles []*Candle) Asset {
+	asset := Asset{}
+	asset.Grow(len(candles))
+	for _, candle := range candles {
+		asset.AddCandle(candle)
+	}
+	return asset
+}
+
+// Grow makes room for n more candles, so adding them does not allocate
+func (a *Asset) Grow(n int) {
+	a.Date = grow(a.Date, n)
+	a.Opening = grow(a.Opening, n)
+	a.Closing = grow(a.Closing, n)
+	a.High = grow(a.High, n)
+	a.Low = grow(a.Low, n)
+	a.Volume = grow(a.Volume, n)
+	a.VolumeInt = grow(a.VolumeInt, n)
+	a.QuoteVolume = grow(a.QuoteVolume, n)
+	a.Change = grow(a.Change, n)
+	a.OpenInterest = grow(a.OpenInterest, n)
+	a.FundingRate = grow(a.FundingRate, n)
+}
+
+// AddCandle appends candle when it is newer than the last candle, which is the common case and takes
+// amortized constant time. Older candles are inserted at their place and replace a candle with the same open time
+func (a *Asset) AddCandle(candle *Candle) {
+	if a.Interval == 0 {
+		a.Interval = candle.Interval
+	}
+
+	start := candle.StartTime()
+	i := a.Len()
+	if i > 0 && !start.After(a.Date[i-1]) {
+		i = sort.Search(a.Len(), func(j int) bool { return !a.Date[j].Before(start) })
+		if a.Date[i].Equal(start) {
+			a.setCandle(i, candle)
+			return
+		}
+	}
+
+	n := a.Len()
+	a.Date = insert(a.Date, n, i, start)
+	a.Opening = insert(a.Opening, n, i, 0)
+	a.Closing = insert(a.Closing, n, i, 0)
+	a.High = insert(a.High, n, i, 0)
+	a.Low = insert(a.Low, n, i, 0)
+	a.Volume = insert(a.Volume, n, i, 0)
+	a.VolumeInt = insert(a.VolumeInt, n, i, 0)
+	a.QuoteVolume = insert(a.QuoteVolume, n, i, 0)
+	a.Change = insert(a.Change, n, i, 0)
+	a.OpenInterest = insert(a.OpenInterest, n, i, 0)
+	a.FundingRate = insert(a.FundingRate, n, i, 0)
+	a.setCandle(i, candle)
+}
+
+// setCandle writes candle to index i of every series that has been filled
+func (a *Asset) setCandle(i int, candle *Candle) {
+	set(a.Date, i, candle.StartTime())
+	set(a.Opening, i, candle.Open)
+	set(a.Closing, i, candle.Close)
+	set(a.High, i, candle.High)
+	set(a.Low, i, candle.Low)
+	set(a.Volume, i, candle.BaseVolume)
+	set(a.VolumeInt, i, int64(candle.BaseVolume))
+	set(a.QuoteVolume, i, candle.QuoteVolume)
+	set(a.Change, i, (candle.Close-candle.Open)/candle.Open*100)
+	set(a.OpenInterest, i, candle.OpenInterest)
+	set(a.FundingRate, i, candle.FundingRate)
+}
+
+// Candle returns the candle at index i
+func (a Asset) Candle(i int) *Candle {
+	candle := &Candle{
+		Open:         valueAt(a.Opening, i),
+		High:         valueAt(a.High, i),
+		Low:          valueAt(a.Low, i),
+		Close:        a.Closing[i],
+		BaseVolume:   valueAt(a.Volume, i),
+		QuoteVolume:  valueAt(a.QuoteVolume, i),
+		OpenTime:     common.Int64ToString(a.Date[i].UnixMilli()),
+		OpenInterest: valueAt(a.OpenInterest, i),
+		FundingRate:  valueAt(a.FundingRate, i),
+	}
+	if a.Interval > 0 {
+		candle.SetInterval(a.Interval)
+	}
+	return candle
+}
+
+// Candles returns all candles ordered from old to new
+func (a Asset) Candles() []*Candle {
+	candles := make([]*Candle, a.Len())
+	for i := range candles {
+		candles[i] = a.Candle(i)
+	}
+	return candles
+}
+
+// IsClosed tells if the candle at index i is final at t. Without an interval no candle is final
+func (a Asset) IsClosed(i int, t time.Time) bool {
+	return a.Interval > 0 && !t.Before(a.Date[i].Add(a.Interval))
+}
+
+// Len returns the number of candles in the asset
+func (a Asset) Len() int {
+	return len(a.Closing)
+}
+
+// Index returns the index of the candle that opens at t
+func (a Asset) Index(t time.Time) (int, bool) {
+	i := a.search(t)
+	return i, i < len(a.Date) && a.Date[i].Equal(t)
+}
+
+// IndexAt returns the index of the last candle that opened at or before t, -1 if t is before the first candle
+func (a Asset) IndexAt(t time.Time) int {
+	i := a.search(t)
+	if i < len(a.Date) && a.Date[i].Equal(t) {
+		return i
+	}
+	return i - 1
+}
+
+// search returns the index of the first candle that opens at or after t
+func (a Asset) search(t time.Time) int {
+	return sort.Search(len(a.Date), func(i int) bool { return !a.Date[i].Before(t) })
+}
+
+// Slice returns the candles from index from up to, but not including, index to
+func (a Asset) Slice(from, to int) Asset {
+	return Asset{
+		Interval:     a.Interval,
+		Date:         sliceOf(a.Date, from, to),
+		Opening:      sliceOf(a.Opening, from, to),
+		Closing:      sliceOf(a.Closing, from, to),
+		High:         sliceOf(a.High, from, to),
+		Low:          sliceOf(a.Low, from, to),
+		Volume:       sliceOf(a.Volume, from, to),
+		VolumeInt:    sliceOf(a.VolumeInt, from, to),
+		QuoteVolume:  sliceOf(a.QuoteVolume, from, to),
+		Change:       sliceOf(a.Change, from, to),
+		OpenInterest: sliceOf(a.OpenInterest, from, to),
+		FundingRate:  sliceOf(a.FundingRate, from, to),
+	}
+}
+
+// Between returns the candles that open from from up to, but not including, to
+func (a Asset) Between(from, to time.Time) Asset {
+	i, j := a.search(from), a.search(to)
+	return a.Slice(i, max(i, j))
+}
+
+// NewestFirst returns a reversed copy of series, for functions that expect the newest value at index 0
+func NewestFirst[T any](series []T) []T {
+	reversed := make([]T, len(series))
+	for i, value := range series {
+		reversed[len(series)-1-i] = value
+	}
+	return reversed
+}
+
+// sliceOf leaves series that have not been filled empty. The slice has no spare capacity, so appending
+// to it copies instead of overwriting the values of series after to
+func sliceOf[T any](series []T, from, to int) []T {
+	if len(series) < to {
+		return nil
+	}
+	return series[from:to:to]
+}
+
+// insert puts value at index i of series holding n values. Series that have not been filled are left alone
+func insert[T any](series []T, n, i int, value T) []T {
+	if len(series) != n {
+		return series
+	}
+	var zero T
+	series = append(series, zero)
+	copy(series[i+1:], series[i:])
+	series[i] = value
+	return series
+}
+
+func set[T any](series []T, i int, value T) {
+	if i < len(series) {
+		series[i] = value
+	}
+}
+
+func grow[T any](series []T, n int) []T {
+	if cap(series)-len(series) >= n {
+		return series
+	}
+	grown := make([]T, len(series), len(series)+n)
+	copy(grown, series)
+	return grown
+}
+
+func valueAt(series []float64, i int) float64 {
+	if i >= len(series) {
+		return 0
+	}
+	return series[i]
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAddCandleToSliceKeepsParent(t *testing.T) {
+	start := time.Date(2024, 10, 10, 0, 0, 0, 0, time.UTC)
+	asset := AssetFromCandles(hourlyCandles(start, 10))
+	closing := append([]float64(nil), asset.Closing...)
+	dates := append([]time.Time(nil), asset.Date...)
+
+	slice := asset.Slice(2, 5)
+	slice.AddCandle(&Candle{Open: 7, High: 9, Low: 6, Close: 8, OpenTime: hourlyCandles(start.Add(5*time.Hour), 1)[0].OpenTime})
+	// a candle between two others is inserted within the slice
+	inner := asset.Slice(2, 5)
+	inner.AddCandle(&Candle{Open: 7, High: 9, Low: 6, Close: 8, OpenTime: hourlyCandles(start.Add(3*time.Hour+30*time.Minute), 1)[0].OpenTime})
+
+	if slice.Len() != 4 || slice.Closing[3] != 8 {
+		t.Errorf("slice has %d candles, last close %v", slice.Len(), slice.Closing[slice.Len()-1])
+	}
+	for i := range closing {
+		if asset.Closing[i] != closing[i] || !asset.Date[i].Equal(dates[i]) {
+			t.Errorf("candle %d of the parent changed to %v at %v", i, asset.Closing[i], asset.Date[i])
+		}
+	}
+}
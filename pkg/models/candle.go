@@ -20,7 +20,12 @@ type Candle struct {
 	BaseVolume  float64 `json:"baseVolume,string" validate:"required"`
 	QuoteVolume float64 `json:"quoteVolume,string" validate:"required"`
 	OpenTime    string  `json:"openTime,date" validate:"required"`
-	CloseTime   int64   `json:"closeTime,date" validate:"required"`
+	// CloseTime is the unix time in seconds the candle closes at, which is the open time of the next candle
+	CloseTime int64         `json:"closeTime,date" validate:"required"`
+	Interval  time.Duration `json:"interval,omitempty"`
+	// OpenInterest and FundingRate are merged in from a separate series, 0 when unknown
+	OpenInterest float64 `json:"openInterest,omitempty"`
+	FundingRate  float64 `json:"fundingRate,omitempty"`
 }
 
 func NewCandle() *Candle {
@@ -29,32 +34,33 @@ func NewCandle() *Candle {
 	return candle
 }
 
-type Asset struct {
-	Date         []time.Time
-	Opening      []float64
-	Closing      []float64
-	High         []float64
-	Low          []float64
-	Volume       []float64
-	VolumeInt    []int64
-	Change       []float64
-	OpenInterest []float64
+// StartTime converts the OpenTime in milliseconds to a time
+func (c *Candle) StartTime() time.Time {
+	return time.Unix(common.StringToInt64(c.OpenTime)/1000, 0)
 }
 
-func (a *Asset) AddCandle(candle *Candle) {
-	a.Date = append([]time.Time{time.Unix(common.StringToInt64(candle.OpenTime)/1000, 0)}, a.Date...)
-	a.Opening = append([]float64{candle.Open}, a.Opening...)
-	a.Closing = append([]float64{candle.Close}, a.Closing...)
-	a.High = append([]float64{candle.High}, a.High...)
-	a.Low = append([]float64{candle.Low}, a.Low...)
-	a.Volume = append([]float64{candle.BaseVolume}, a.Volume...)
-	a.VolumeInt = append([]int64{int64(candle.BaseVolume)}, a.VolumeInt...)
-	change := (candle.Close - candle.Open) / candle.Open * 100
-	a.Change = append([]float64{change}, a.Change...)
+// EndTime converts the CloseTime to a time
+func (c *Candle) EndTime() time.Time {
+	return time.Unix(c.CloseTime, 0)
 }
 
+// SetInterval sets the interval and the close time that follows from it
+func (c *Candle) SetInterval(interval time.Duration) {
+	c.Interval = interval
+	c.CloseTime = c.StartTime().Add(interval).Unix()
+}
+
+// IsClosed tells if the candle is final at t. Candles without a close time are never final
+func (c *Candle) IsClosed(t time.Time) bool {
+	return c.CloseTime != 0 && !t.Before(c.EndTime())
+}
 
 func PlotCandlestickChart(data []float64, dates []time.Time, market string) {
+	SaveCandlestickChart(data, dates, market, "chart.png")
+}
+
+// SaveCandlestickChart plots the closing prices like PlotCandlestickChart into the file at path
+func SaveCandlestickChart(data []float64, dates []time.Time, market, path string) {
 	p := plot.New()
 
 	p.Title.Text = fmt.Sprintf("Candlestick chart for %s", market)
@@ -79,7 +85,7 @@ func PlotCandlestickChart(data []float64, dates []time.Time, market string) {
 	p.Legend.Add("Close", lineClose)
 
 	// Save the plot to a file or display it
-	if err := p.Save(6*vg.Inch, 4*vg.Inch, "chart.png"); err != nil {
+	if err := p.Save(6*vg.Inch, 4*vg.Inch, path); err != nil {
 		log.Fatal(err)
 	}
 }
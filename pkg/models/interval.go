@@ -0,0 +1,72 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Day  = 24 * time.Hour
+	Week = 7 * Day
+)
+
+// ParseInterval reads intervals like 15m, 4h, 1d or 1w
+func ParseInterval(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 {
+		return 0, fmt.Errorf("invalid interval %q", s)
+	}
+
+	units := map[byte]time.Duration{'s': time.Second, 'm': time.Minute, 'h': time.Hour, 'd': Day, 'w': Week}
+	unit, ok := units[s[len(s)-1]]
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if !ok || err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid interval %q", s)
+	}
+
+	return time.Duration(n) * unit, nil
+}
+
+// FormatInterval writes interval in the largest unit that divides it, the opposite of ParseInterval
+func FormatInterval(interval time.Duration) string {
+	units := []struct {
+		suffix string
+		length time.Duration
+	}{{"w", Week}, {"d", Day}, {"h", time.Hour}, {"m", time.Minute}, {"s", time.Second}}
+
+	for _, unit := range units {
+		if interval >= unit.length && interval%unit.length == 0 {
+			return fmt.Sprintf("%d%s", interval/unit.length, unit.suffix)
+		}
+	}
+	return interval.String()
+}
+
+// SetInterval sets the interval of all candles without one and their close time. An interval of 0 is
+// inferred from the candles, which have to be ordered from old to new
+func SetInterval(candles []*Candle, interval time.Duration) {
+	if interval == 0 {
+		interval = InferInterval(candles)
+	}
+	if interval <= 0 {
+		return
+	}
+
+	for _, candle := range candles {
+		if candle.Interval == 0 {
+			candle.SetInterval(interval)
+		}
+	}
+}
+
+// intervalOf returns the interval of the first candle that has one, or infers it from the candles
+func intervalOf(candles []*Candle) time.Duration {
+	for _, candle := range candles {
+		if candle.Interval > 0 {
+			return candle.Interval
+		}
+	}
+	return InferInterval(candles)
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIntervalRoundTrip(t *testing.T) {
+	// the intervals of Bybit and Binance klines, and seconds
+	tests := []struct {
+		name     string
+		interval time.Duration
+	}{
+		{"1s", time.Second},
+		{"1m", time.Minute},
+		{"3m", 3 * time.Minute},
+		{"5m", 5 * time.Minute},
+		{"15m", 15 * time.Minute},
+		{"30m", 30 * time.Minute},
+		{"1h", time.Hour},
+		{"2h", 2 * time.Hour},
+		{"4h", 4 * time.Hour},
+		{"6h", 6 * time.Hour},
+		{"8h", 8 * time.Hour},
+		{"12h", 12 * time.Hour},
+		{"1d", Day},
+		{"3d", 3 * Day},
+		{"1w", Week},
+		{"2w", 2 * Week},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			interval, err := ParseInterval(test.name)
+			if err != nil || interval != test.interval {
+				t.Fatalf("ParseInterval(%q) = %v, %v, want %v", test.name, interval, err, test.interval)
+			}
+			if name := FormatInterval(test.interval); name != test.name {
+				t.Errorf("FormatInterval(%v) = %q, want %q", test.interval, name, test.name)
+			}
+		})
+	}
+}
+
+func TestParseInterval(t *testing.T) {
+	tests := []struct {
+		input    string
+		interval time.Duration
+		// name is written by FormatInterval, in the largest unit that divides the interval
+		name string
+	}{
+		{"60m", time.Hour, "1h"},
+		{"90m", 90 * time.Minute, "90m"},
+		{"24h", Day, "1d"},
+		{"36h", 36 * time.Hour, "36h"},
+		{"7d", Week, "1w"},
+		{"120s", 2 * time.Minute, "2m"},
+		{" 4h ", 4 * time.Hour, "4h"},
+	}
+	for _, test := range tests {
+		interval, err := ParseInterval(test.input)
+		if err != nil || interval != test.interval {
+			t.Errorf("ParseInterval(%q) = %v, %v, want %v", test.input, interval, err, test.interval)
+			continue
+		}
+		if name := FormatInterval(interval); name != test.name {
+			t.Errorf("FormatInterval(%v) = %q, want %q", interval, name, test.name)
+		}
+	}
+
+	for _, input := range []string{"", "h", "4", "0h", "-1h", "4x", "1.5h", "4H", "h4", "4 h"} {
+		if interval, err := ParseInterval(input); err == nil {
+			t.Errorf("ParseInterval(%q) = %v, want an error", input, interval)
+		}
+	}
+
+	// durations below a second are left to time.Duration
+	if name := FormatInterval(1500 * time.Millisecond); name != "1.5s" {
+		t.Errorf("FormatInterval(1.5s) = %q", name)
+	}
+}
+
+func TestInferInterval(t *testing.T) {
+	start := time.Date(2024, 10, 10, 0, 0, 0, 0, time.UTC)
+	without := func(candles []*Candle, indices ...int) []*Candle {
+		kept := []*Candle{}
+		for i, candle := range candles {
+			drop := false
+			for _, index := range indices {
+				drop = drop || i == index
+			}
+			if !drop {
+				kept = append(kept, candle)
+			}
+		}
+		return kept
+	}
+	tests := []struct {
+		name     string
+		candles  []*Candle
+		interval time.Duration
+	}{
+		{"regular", hourlyCandles(start, 10), time.Hour},
+		{"a few gaps", without(hourlyCandles(start, 20), 3, 4, 9, 15), time.Hour},
+		{"a gap every third candle", without(hourlyCandles(start, 12), 2, 5, 8), time.Hour},
+		{"every other candle", without(hourlyCandles(start, 12), 1, 3, 5, 7, 9, 11), 2 * time.Hour},
+		// 1h and 2h apart as often, the shorter one wins
+		{"tie", without(hourlyCandles(start, 7), 2, 5), time.Hour},
+		{"duplicates", append(hourlyCandles(start, 3), hourlyCandles(start.Add(2*time.Hour), 3)...), time.Hour},
+		{"one candle", hourlyCandles(start, 1), 0},
+		{"no candles", nil, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if interval := InferInterval(test.candles); interval != test.interval {
+				t.Errorf("got %v, want %v", interval, test.interval)
+			}
+		})
+	}
+}
+
+func TestSetInterval(t *testing.T) {
+	start := time.Date(2024, 10, 10, 0, 0, 0, 0, time.UTC)
+	candles := hourlyCandles(start, 6)
+	candles = append(candles[:2], candles[4:]...)
+	candles[0].Interval = 30 * time.Minute
+
+	SetInterval(candles, 0)
+	for i, candle := range candles[1:] {
+		if candle.Interval != time.Hour || !candle.EndTime().Equal(candle.StartTime().Add(time.Hour)) {
+			t.Errorf("candle %d has interval %v and ends at %v, want 1h", i+1, candle.Interval, candle.EndTime())
+		}
+	}
+	if candles[0].Interval != 30*time.Minute {
+		t.Errorf("the interval of the first candle was replaced by %v", candles[0].Interval)
+	}
+	// a candle with an interval is taken over inference
+	if interval := intervalOf(candles); interval != 30*time.Minute {
+		t.Errorf("intervalOf = %v, want the 30m of the first candle", interval)
+	}
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// Point is a value of a series that is published separately from the candles, like open interest or funding
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// MergeOpenInterest sets the open interest of every candle to the last point before it closes
+func MergeOpenInterest(candles []*Candle, points []Point) {
+	merge(candles, points, func(candle *Candle, value float64) { candle.OpenInterest = value })
+}
+
+// MergeFundingRate sets the funding rate of every candle to the last point before it closes
+func MergeFundingRate(candles []*Candle, points []Point) {
+	merge(candles, points, func(candle *Candle, value float64) { candle.FundingRate = value })
+}
+
+// merge sets the value of the last point before the close of every candle, or at its open when the close
+// time is unknown. Candles before the first point are left alone
+func merge(candles []*Candle, points []Point, set func(candle *Candle, value float64)) {
+	sorted := make([]Point, len(points))
+	copy(sorted, points)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+
+	for _, candle := range candles {
+		// index of the first point that is too late for the candle
+		i := sort.Search(len(sorted), func(i int) bool { return !sorted[i].Time.Before(candle.EndTime()) })
+		if candle.CloseTime == 0 {
+			i = sort.Search(len(sorted), func(i int) bool { return sorted[i].Time.After(candle.StartTime()) })
+		}
+		if i > 0 {
+			set(candle, sorted[i-1].Value)
+		}
+	}
+}
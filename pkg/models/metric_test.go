@@ -0,0 +1,91 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMergeOpenInterest(t *testing.T) {
+	start := time.Date(2024, 10, 10, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	tests := []struct {
+		name   string
+		points []Point
+		// closed merges into candles with a close time, open into candles without one
+		closed, open []float64
+	}{
+		{
+			"points between the candles",
+			[]Point{{at(-30), 1}, {at(30), 2}, {at(90), 3}},
+			[]float64{2, 3, 3, 3}, []float64{1, 2, 3, 3},
+		},
+		{
+			// a point at the close of a candle belongs to the next one
+			"points on the candle times",
+			[]Point{{at(0), 1}, {at(60), 2}, {at(120), 3}, {at(180), 4}},
+			[]float64{1, 2, 3, 4}, []float64{1, 2, 3, 4},
+		},
+		{
+			"points out of order",
+			[]Point{{at(150), 3}, {at(30), 1}, {at(90), 2}},
+			[]float64{1, 2, 3, 3}, []float64{-1, 1, 2, 3},
+		},
+		{
+			// candles before the first point keep their value
+			"points after the first candles",
+			[]Point{{at(170), 5}},
+			[]float64{-1, -1, 5, 5}, []float64{-1, -1, -1, 5},
+		},
+		{"no points", nil, []float64{-1, -1, -1, -1}, []float64{-1, -1, -1, -1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			closed := hourlyCandles(start, 4)
+			open := hourlyCandles(start, 4)
+			for i := range closed {
+				closed[i].SetInterval(time.Hour)
+				closed[i].OpenInterest, open[i].OpenInterest = -1, -1
+			}
+
+			MergeOpenInterest(closed, test.points)
+			MergeOpenInterest(open, test.points)
+			if got := openInterest(closed); !reflect.DeepEqual(got, test.closed) {
+				t.Errorf("candles with a close time got %v, want %v", got, test.closed)
+			}
+			if got := openInterest(open); !reflect.DeepEqual(got, test.open) {
+				t.Errorf("candles without a close time got %v, want %v", got, test.open)
+			}
+		})
+	}
+}
+
+func TestMergeFundingRate(t *testing.T) {
+	start := time.Date(2024, 10, 10, 0, 0, 0, 0, time.UTC)
+	candles := hourlyCandles(start, 10)
+	for _, candle := range candles {
+		candle.SetInterval(time.Hour)
+	}
+	// funding is paid every 8 hours, the candles in between keep the last rate
+	points := []Point{{start.Add(-8 * time.Hour), 0.0001}, {start.Add(8 * time.Hour), -0.0002}}
+
+	MergeFundingRate(candles, points)
+	for i, candle := range candles {
+		want := 0.0001
+		if i >= 8 {
+			want = -0.0002
+		}
+		if candle.FundingRate != want || candle.OpenInterest != 0 {
+			t.Errorf("candle %d has funding rate %v and open interest %v, want %v and 0", i, candle.FundingRate, candle.OpenInterest, want)
+		}
+	}
+}
+
+func openInterest(candles []*Candle) []float64 {
+	values := make([]float64, len(candles))
+	for i, candle := range candles {
+		values[i] = candle.OpenInterest
+	}
+	return values
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/divergence/pkg/common"
+)
+
+// ResampleConfig describes the candles Resample builds
+type ResampleConfig struct {
+	// Interval is the length of the resampled candles
+	Interval time.Duration
+	// SourceInterval is the length of the input candles. 0 takes it from the candles or infers it from the gaps between them
+	SourceInterval time.Duration
+	// Location is the timezone of the session. nil uses UTC
+	Location *time.Location
+	// SessionStart is the time of day, in Location, on which daily and longer candles open, weekly candles
+	// open on Monday. Shorter candles are aligned to it as well, so a 4h candle opens at SessionStart,
+	// SessionStart + 4h and so on. Intraday intervals that do not divide a day end early at the start of
+	// the next session
+	SessionStart time.Duration
+	// DropPartial drops candles that are not covered completely by input candles, like the last candle
+	// of a day that is still running
+	DropPartial bool
+}
+
+func (c ResampleConfig) location() *time.Location {
+	if c.Location == nil {
+		return time.UTC
+	}
+	return c.Location
+}
+
+// Resample aggregates candles into candles of config.Interval. The input does not need to be sorted,
+// the result is ordered from old to new
+func Resample(candles []*Candle, config ResampleConfig) ([]*Candle, error) {
+	if config.Interval <= 0 {
+		return nil, fmt.Errorf("interval must be > 0, got %v", config.Interval)
+	}
+	if config.SessionStart < 0 || config.SessionStart >= 24*time.Hour {
+		return nil, fmt.Errorf("session start must be within a day, got %v", config.SessionStart)
+	}
+	if len(candles) == 0 {
+		return nil, nil
+	}
+
+	sorted := make([]*Candle, len(candles))
+	copy(sorted, candles)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].StartTime().Before(sorted[j].StartTime()) })
+
+	sourceInterval := config.SourceInterval
+	if sourceInterval == 0 {
+		sourceInterval = intervalOf(sorted)
+	}
+	if sourceInterval <= 0 {
+		return nil, errors.New("cannot infer the interval of the input candles")
+	}
+	if sourceInterval > config.Interval {
+		return nil, fmt.Errorf("cannot resample %v candles to the shorter interval %v", sourceInterval, config.Interval)
+	}
+
+	resampled := []*Candle{}
+	var current *Candle
+	var start, end time.Time
+	count := 0
+
+	flush := func() {
+		if current == nil {
+			return
+		}
+		if !config.DropPartial || time.Duration(count)*sourceInterval >= end.Sub(start) {
+			resampled = append(resampled, current)
+		}
+	}
+
+	for _, candle := range sorted {
+		t := candle.StartTime()
+		if current != nil && t.Before(end) {
+			current.High = max(current.High, candle.High)
+			current.Low = min(current.Low, candle.Low)
+			current.Close = candle.Close
+			current.BaseVolume += candle.BaseVolume
+			current.QuoteVolume += candle.QuoteVolume
+			current.OpenInterest = candle.OpenInterest
+			current.FundingRate = candle.FundingRate
+			count++
+			continue
+		}
+
+		flush()
+		start, end = config.bucket(t)
+		count = 1
+		current = &Candle{
+			Open:        candle.Open,
+			High:        candle.High,
+			Low:         candle.Low,
+			Close:       candle.Close,
+			BaseVolume:  candle.BaseVolume,
+			QuoteVolume: candle.QuoteVolume,
+			OpenTime:    common.Int64ToString(start.UnixMilli()),
+			CloseTime:   end.Unix(),
+			Interval:    config.Interval,
+			// open interest and funding are levels, the resampled candle takes the last one
+			OpenInterest: candle.OpenInterest,
+			FundingRate:  candle.FundingRate,
+		}
+	}
+	flush()
+
+	return resampled, nil
+}
+
+// bucket returns the start and the end of the resampled candle t falls in
+func (c ResampleConfig) bucket(t time.Time) (time.Time, time.Time) {
+	loc := c.location()
+	local := t.In(loc)
+
+	sessionStart := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc).Add(c.SessionStart)
+	if sessionStart.After(local) {
+		sessionStart = time.Date(local.Year(), local.Month(), local.Day()-1, 0, 0, 0, 0, loc).Add(c.SessionStart)
+	}
+
+	day := 24 * time.Hour
+	if c.Interval%day == 0 {
+		// count calendar days, so candles keep opening at the same local time over daylight saving changes
+		days := int(c.Interval / day)
+		epoch := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+		if c.Interval%Week == 0 {
+			// weeks open on Monday, like on the exchanges and in charting tools, and 1970-01-05 is a Monday
+			epoch = time.Date(1970, 1, 5, 0, 0, 0, 0, time.UTC)
+		}
+		civil := time.Date(sessionStart.Year(), sessionStart.Month(), sessionStart.Day(), 0, 0, 0, 0, time.UTC)
+		offset := (int(civil.Sub(epoch)/day)%days + days) % days
+
+		start := time.Date(sessionStart.Year(), sessionStart.Month(), sessionStart.Day()-offset, 0, 0, 0, 0, loc).Add(c.SessionStart)
+		end := time.Date(start.Year(), start.Month(), start.Day()+days, 0, 0, 0, 0, loc).Add(c.SessionStart)
+		return start, end
+	}
+
+	// intraday candles are cut at the end of the session when the interval does not divide a day
+	start := sessionStart.Add(local.Sub(sessionStart) / c.Interval * c.Interval)
+	nextSession := time.Date(sessionStart.Year(), sessionStart.Month(), sessionStart.Day()+1, 0, 0, 0, 0, loc).Add(c.SessionStart)
+	if end := start.Add(c.Interval); end.Before(nextSession) {
+		return start, end
+	}
+	return start, nextSession
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/divergence/pkg/common"
+)
+
+// hourlyCandles returns n 1h candles from start
+func hourlyCandles(start time.Time, n int) []*Candle {
+	candles := make([]*Candle, n)
+	for i := range candles {
+		open := start.Add(time.Duration(i) * time.Hour)
+		candles[i] = &Candle{Open: 1, High: 2, Low: 1, Close: 2, BaseVolume: 1, OpenTime: common.Int64ToString(open.UnixMilli())}
+	}
+	return candles
+}
+
+func TestResampleWeeksOpenOnMonday(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		location *time.Location
+		session  time.Duration
+	}{
+		{"week", Week, nil, 0},
+		{"two weeks", 2 * Week, nil, 0},
+		{"week with session", Week, newYork, 17 * time.Hour},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// starts on a Thursday
+			candles := hourlyCandles(time.Date(2024, 10, 10, 0, 0, 0, 0, time.UTC), 60*24)
+			resampled, err := Resample(candles, ResampleConfig{Interval: test.interval, Location: test.location, SessionStart: test.session})
+			if err != nil {
+				t.Fatal(err)
+			}
+			location := test.location
+			if location == nil {
+				location = time.UTC
+			}
+			for _, candle := range resampled {
+				open := candle.StartTime().In(location)
+				if open.Weekday() != time.Monday || time.Duration(open.Hour())*time.Hour != test.session {
+					t.Errorf("candle opens on %v", open)
+				}
+			}
+		})
+	}
+}
+
+func TestResampleDays(t *testing.T) {
+	candles := hourlyCandles(time.Date(2024, 10, 10, 5, 0, 0, 0, time.UTC), 24*3)
+	resampled, err := Resample(candles, ResampleConfig{Interval: Day})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resampled) != 4 {
+		t.Fatalf("got %d candles, want 4", len(resampled))
+	}
+	for i, candle := range resampled {
+		if want := time.Date(2024, 10, 10+i, 0, 0, 0, 0, time.UTC); !candle.StartTime().Equal(want) {
+			t.Errorf("candle %d opens at %v, want %v", i, candle.StartTime(), want)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/divergence/pkg/common"
+)
+
+// IssueKind is the kind of problem Validate found in a candle
+type IssueKind int
+
+const (
+	Duplicate IssueKind = iota
+	OutOfOrder
+	Gap
+	NonPositivePrice
+	InconsistentOHLC
+	// ZeroVolume is a candle whose price moved without volume
+	ZeroVolume
+	// Filled is a flat candle without volume, like the candles Repair fills gaps with or one nothing traded
+	// in. It is reported, but does not fail the report
+	Filled
+)
+
+func (k IssueKind) String() string {
+	switch k {
+	case Duplicate:
+		return "duplicate"
+	case OutOfOrder:
+		return "out of order"
+	case Gap:
+		return "gap"
+	case NonPositivePrice:
+		return "non-positive price"
+	case InconsistentOHLC:
+		return "inconsistent OHLC"
+	case ZeroVolume:
+		return "zero volume"
+	case Filled:
+		return "filled"
+	default:
+		return fmt.Sprintf("issue(%d)", int(k))
+	}
+}
+
+// Issue is a problem with the candle at Index of the validated slice
+type Issue struct {
+	Kind    IssueKind
+	Index   int
+	Time    time.Time
+	Message string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s at %d (%v): %s", i.Kind, i.Index, i.Time, i.Message)
+}
+
+// ValidationReport lists the issues of a slice of candles
+type ValidationReport struct {
+	// Interval is the interval the gaps were measured against
+	Interval time.Duration
+	Issues   []Issue
+}
+
+// OK tells if no issue other than filled candles was found
+func (r ValidationReport) OK() bool {
+	return len(r.Issues) == r.Count(Filled)
+}
+
+// Count returns the number of issues of kind
+func (r ValidationReport) Count(kind IssueKind) int {
+	count := 0
+	for _, issue := range r.Issues {
+		if issue.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+// Validate checks candles, which should be ordered from old to new. An interval of 0 is taken from the
+// candles or inferred from them
+func Validate(candles []*Candle, interval time.Duration) ValidationReport {
+	if interval == 0 {
+		interval = intervalOf(candles)
+	}
+	report := ValidationReport{Interval: interval}
+
+	add := func(kind IssueKind, i int, format string, args ...interface{}) {
+		report.Issues = append(report.Issues, Issue{Kind: kind, Index: i, Time: candles[i].StartTime(), Message: fmt.Sprintf(format, args...)})
+	}
+
+	for i, candle := range candles {
+		if i > 0 {
+			previous := candles[i-1].StartTime()
+			current := candle.StartTime()
+			switch {
+			case current.Equal(previous):
+				add(Duplicate, i, "same open time as candle %d", i-1)
+			case current.Before(previous):
+				add(OutOfOrder, i, "opens before candle %d at %v", i-1, previous)
+			case interval > 0 && current.Sub(previous) > interval:
+				add(Gap, i, "%d candles missing since %v", int(current.Sub(previous)/interval)-1, previous)
+			}
+		}
+
+		if problem := priceProblem(candle); problem != "" {
+			kind := InconsistentOHLC
+			if candle.Open <= 0 || candle.High <= 0 || candle.Low <= 0 || candle.Close <= 0 {
+				kind = NonPositivePrice
+			}
+			add(kind, i, "%s", problem)
+		}
+
+		switch {
+		case candle.BaseVolume != 0:
+		case candle.High == candle.Low:
+			add(Filled, i, "no volume traded at %v", candle.Close)
+		default:
+			add(ZeroVolume, i, "no volume traded, but the price moved from %v to %v", candle.Low, candle.High)
+		}
+	}
+
+	return report
+}
+
+// priceProblem describes what is wrong with the prices of candle, or returns an empty string
+func priceProblem(candle *Candle) string {
+	if candle.Open <= 0 || candle.High <= 0 || candle.Low <= 0 || candle.Close <= 0 {
+		return fmt.Sprintf("open %v, high %v, low %v, close %v", candle.Open, candle.High, candle.Low, candle.Close)
+	}
+	if candle.High < candle.Low {
+		return fmt.Sprintf("high %v is below low %v", candle.High, candle.Low)
+	}
+	if candle.High < max(candle.Open, candle.Close) || candle.Low > min(candle.Open, candle.Close) {
+		return fmt.Sprintf("open %v and close %v are not within low %v and high %v", candle.Open, candle.Close, candle.Low, candle.High)
+	}
+	return ""
+}
+
+// RepairStrategy tells Repair what to do with bad candles and gaps
+type RepairStrategy int
+
+const (
+	// DropBars removes bad candles and leaves gaps open
+	DropBars RepairStrategy = iota
+	// ForwardFill replaces bad candles and fills gaps with flat candles at the previous close
+	ForwardFill
+	// Interpolate replaces bad candles and fills gaps with candles on the line from the previous close to the next open
+	Interpolate
+)
+
+// Repair sorts candles, keeps the last of duplicate candles and fixes bad prices and gaps with strategy.
+// Candles without volume are kept, they are common in quiet markets. The filled candles are flat and have
+// no volume, Validate reports them as Filled. An interval of 0 is taken from the candles or inferred from them
+func Repair(candles []*Candle, strategy RepairStrategy, interval time.Duration) ([]*Candle, error) {
+	if strategy < DropBars || strategy > Interpolate {
+		return nil, fmt.Errorf("unknown repair strategy %d", int(strategy))
+	}
+
+	sorted := make([]*Candle, len(candles))
+	copy(sorted, candles)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].StartTime().Before(sorted[j].StartTime()) })
+
+	unique := []*Candle{}
+	for _, candle := range sorted {
+		if len(unique) > 0 && unique[len(unique)-1].StartTime().Equal(candle.StartTime()) {
+			unique[len(unique)-1] = candle
+			continue
+		}
+		unique = append(unique, candle)
+	}
+
+	if interval == 0 {
+		interval = intervalOf(unique)
+	}
+	if interval <= 0 && strategy != DropBars {
+		return nil, fmt.Errorf("cannot fill gaps without an interval")
+	}
+
+	// keep the good candles, the bad ones are rebuilt like missing ones
+	good := []*Candle{}
+	for _, candle := range unique {
+		if priceProblem(candle) == "" {
+			good = append(good, candle)
+		}
+	}
+	if strategy == DropBars || len(good) == 0 {
+		return good, nil
+	}
+
+	repaired := []*Candle{good[0]}
+	for _, candle := range good[1:] {
+		previous := repaired[len(repaired)-1]
+		missing := int(candle.StartTime().Sub(previous.StartTime())/interval) - 1
+
+		for n := 1; n <= missing; n++ {
+			price := previous.Close
+			if strategy == Interpolate {
+				price = previous.Close + (candle.Open-previous.Close)*float64(n)/float64(missing+1)
+			}
+			start := previous.StartTime().Add(time.Duration(n) * interval)
+			repaired = append(repaired, &Candle{
+				Open:      price,
+				High:      price,
+				Low:       price,
+				Close:     price,
+				OpenTime:  common.Int64ToString(start.UnixMilli()),
+				CloseTime: start.Add(interval).Unix(),
+				Interval:  interval,
+				// nothing is known about the missing candles, so the levels of the previous one are kept
+				OpenInterest: previous.OpenInterest,
+				FundingRate:  previous.FundingRate,
+			})
+		}
+		repaired = append(repaired, candle)
+	}
+
+	return repaired, nil
+}
+
+// InferInterval returns the most common gap between the start of consecutive candles, the shorter one on a tie
+func InferInterval(candles []*Candle) time.Duration {
+	counts := make(map[time.Duration]int)
+	for i := 1; i < len(candles); i++ {
+		if gap := candles[i].StartTime().Sub(candles[i-1].StartTime()); gap > 0 {
+			counts[gap]++
+		}
+	}
+
+	var interval time.Duration
+	for gap, count := range counts {
+		if count > counts[interval] || count == counts[interval] && gap < interval {
+			interval = gap
+		}
+	}
+	return interval
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRepairedCandlesValidate(t *testing.T) {
+	start := time.Date(2024, 10, 10, 0, 0, 0, 0, time.UTC)
+	candles := hourlyCandles(start, 10)
+	// a gap of three candles and a candle with its high below its low
+	candles = append(candles[:3], candles[6:]...)
+	candles[5].High = 0.5
+
+	if report := Validate(candles, time.Hour); report.Count(Gap) != 1 || report.Count(InconsistentOHLC) != 1 {
+		t.Fatalf("got issues %v, want a gap and an inconsistent candle", report.Issues)
+	}
+	for _, strategy := range []RepairStrategy{ForwardFill, Interpolate} {
+		repaired, err := Repair(candles, strategy, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(repaired) != 10 {
+			t.Fatalf("strategy %d: got %d candles, want 10", strategy, len(repaired))
+		}
+		// the three missing candles and the inconsistent one are rebuilt flat and without volume
+		if report := Validate(repaired, time.Hour); !report.OK() || report.Count(Filled) != 4 {
+			t.Errorf("strategy %d: repaired candles have issues %v, want 4 filled candles", strategy, report.Issues)
+		}
+	}
+}
+
+func TestZeroVolume(t *testing.T) {
+	candles := hourlyCandles(time.Date(2024, 10, 10, 0, 0, 0, 0, time.UTC), 3)
+	candles[0].Open, candles[0].High, candles[0].Low, candles[0].Close = 10, 12, 9, 11
+	candles[1].Open, candles[1].High, candles[1].Low, candles[1].Close = 11, 11, 11, 11
+	candles[2].Open, candles[2].High, candles[2].Low, candles[2].Close = 11, 11, 11, 11
+	candles[0].BaseVolume, candles[1].BaseVolume = 0, 0
+
+	report := Validate(candles, time.Hour)
+	want := []Issue{
+		{Kind: ZeroVolume, Index: 0, Time: candles[0].StartTime(), Message: "no volume traded, but the price moved from 9 to 12"},
+		{Kind: Filled, Index: 1, Time: candles[1].StartTime(), Message: "no volume traded at 11"},
+	}
+	if !reflect.DeepEqual(report.Issues, want) {
+		t.Errorf("got issues %v, want %v", report.Issues, want)
+	}
+	if report.OK() {
+		t.Error("a candle that moved without volume passed")
+	}
+	if report := Validate(candles[1:], time.Hour); !report.OK() || report.Count(Filled) != 1 {
+		t.Errorf("got issues %v, want a filled candle that passes", report.Issues)
+	}
+}
@@ -0,0 +1,152 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/divergence/pkg/models"
+	"github.com/divergence/pkg/ta/divergence_detection"
+)
+
+// Format is the encoding divergences are written in
+type Format string
+
+const (
+	Text   Format = "text"
+	JSON   Format = "json"
+	NDJSON Format = "ndjson"
+	CSV    Format = "csv"
+)
+
+// ParseFormat returns the format called name
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(name); format {
+	case Text, JSON, NDJSON, CSV:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown output format %q, expected text, json, ndjson or csv", name)
+	}
+}
+
+// Record is a divergence with the field names downstream tools rely on. Fields are only ever added,
+// new ones go to the end of the CSV columns
+type Record struct {
+	Symbol    string `json:"symbol"`
+	Interval  string `json:"interval"`
+	Type      string `json:"type"`
+	Kind      string `json:"kind"`
+	Direction string `json:"direction"`
+	Indicator string `json:"indicator"`
+
+	PricePivot1Time      time.Time `json:"pricePivot1Time"`
+	PricePivot1Price     float64   `json:"pricePivot1Price"`
+	PricePivot2Time      time.Time `json:"pricePivot2Time"`
+	PricePivot2Price     float64   `json:"pricePivot2Price"`
+	IndicatorPivot1Time  time.Time `json:"indicatorPivot1Time"`
+	IndicatorPivot1Value float64   `json:"indicatorPivot1Value"`
+	IndicatorPivot2Time  time.Time `json:"indicatorPivot2Time"`
+	IndicatorPivot2Value float64   `json:"indicatorPivot2Value"`
+	ConfirmationTime     time.Time `json:"confirmationTime"`
+
+	Score float64 `json:"score"`
+}
+
+// NewRecord flattens d. An interval of 0 is left empty
+func NewRecord(symbol string, interval time.Duration, d divergence_detection.Divergence) Record {
+	record := Record{
+		Symbol:    symbol,
+		Type:      d.Type(),
+		Kind:      d.Kind.String(),
+		Direction: d.Direction.String(),
+		Indicator: d.Indicator,
+
+		PricePivot1Time:      d.PricePivots[0].Time.UTC(),
+		PricePivot1Price:     d.PricePivots[0].Value,
+		PricePivot2Time:      d.PricePivots[1].Time.UTC(),
+		PricePivot2Price:     d.PricePivots[1].Value,
+		IndicatorPivot1Time:  d.IndicatorPivots[0].Time.UTC(),
+		IndicatorPivot1Value: d.IndicatorPivots[0].Value,
+		IndicatorPivot2Time:  d.IndicatorPivots[1].Time.UTC(),
+		IndicatorPivot2Value: d.IndicatorPivots[1].Value,
+		ConfirmationTime:     d.ConfirmationTime.UTC(),
+
+		Score: d.Score.Total,
+	}
+	if interval > 0 {
+		record.Interval = models.FormatInterval(interval)
+	}
+	return record
+}
+
+// csvHeader is the order of the CSV columns, it matches the JSON field names
+var csvHeader = []string{
+	"symbol", "interval", "type", "kind", "direction", "indicator",
+	"pricePivot1Time", "pricePivot1Price", "pricePivot2Time", "pricePivot2Price",
+	"indicatorPivot1Time", "indicatorPivot1Value", "indicatorPivot2Time", "indicatorPivot2Value",
+	"confirmationTime", "score",
+}
+
+func (r Record) csvRow() []string {
+	return []string{
+		r.Symbol, r.Interval, r.Type, r.Kind, r.Direction, r.Indicator,
+		formatTime(r.PricePivot1Time), formatFloat(r.PricePivot1Price),
+		formatTime(r.PricePivot2Time), formatFloat(r.PricePivot2Price),
+		formatTime(r.IndicatorPivot1Time), formatFloat(r.IndicatorPivot1Value),
+		formatTime(r.IndicatorPivot2Time), formatFloat(r.IndicatorPivot2Value),
+		formatTime(r.ConfirmationTime), formatFloat(r.Score),
+	}
+}
+
+// Write writes records to w in format. JSON is a single array, NDJSON one object per line and CSV has a header
+func Write(w io.Writer, format Format, records []Record) error {
+	switch format {
+	case Text:
+		for _, r := range records {
+			if _, err := fmt.Fprintf(w, "%s %s %s %s divergence: %s (score %.2f)\n", r.Symbol, r.Interval, r.Kind, r.Direction, formatTime(r.ConfirmationTime), r.Score); err != nil {
+				return err
+			}
+		}
+		return nil
+	case JSON:
+		if records == nil {
+			records = []Record{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	case NDJSON:
+		encoder := json.NewEncoder(w)
+		for _, r := range records {
+			if err := encoder.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	case CSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(csvHeader); err != nil {
+			return err
+		}
+		for _, r := range records {
+			if err := writer.Write(r.csvRow()); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+func formatTime(t time.Time) string {
+	return t.Format(time.RFC3339)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,147 @@
+package output
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/divergence/pkg/ta/divergence_detection"
+)
+
+func testRecords() []Record {
+	at := func(hour int) time.Time { return time.Date(2024, 10, 1, hour, 0, 0, 0, time.UTC) }
+	d := divergence_detection.Divergence{
+		Kind:             divergence_detection.Regular,
+		Direction:        divergence_detection.Bullish,
+		Indicator:        "RSI(14)",
+		ConfirmationTime: at(20),
+	}
+	d.PricePivots = [2]divergence_detection.Pivot{{Time: at(0), Value: 100.5}, {Time: at(12), Value: 98}}
+	d.IndicatorPivots = [2]divergence_detection.Pivot{{Time: at(4), Value: 25.25}, {Time: at(12), Value: 31}}
+	d.Score.Total = 0.75
+
+	// a zero interval is left empty
+	return []Record{NewRecord("BTCUSDT", 4*time.Hour, d), NewRecord("ETHUSDT", 0, d)}
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{Text, `BTCUSDT 4h regular bullish divergence: 2024-10-01T20:00:00Z (score 0.75)
+ETHUSDT  regular bullish divergence: 2024-10-01T20:00:00Z (score 0.75)
+`},
+		{JSON, `[
+  {
+    "symbol": "BTCUSDT",
+    "interval": "4h",
+    "type": "regular_bullish",
+    "kind": "regular",
+    "direction": "bullish",
+    "indicator": "RSI(14)",
+    "pricePivot1Time": "2024-10-01T00:00:00Z",
+    "pricePivot1Price": 100.5,
+    "pricePivot2Time": "2024-10-01T12:00:00Z",
+    "pricePivot2Price": 98,
+    "indicatorPivot1Time": "2024-10-01T04:00:00Z",
+    "indicatorPivot1Value": 25.25,
+    "indicatorPivot2Time": "2024-10-01T12:00:00Z",
+    "indicatorPivot2Value": 31,
+    "confirmationTime": "2024-10-01T20:00:00Z",
+    "score": 0.75
+  },
+  {
+    "symbol": "ETHUSDT",
+    "interval": "",
+    "type": "regular_bullish",
+    "kind": "regular",
+    "direction": "bullish",
+    "indicator": "RSI(14)",
+    "pricePivot1Time": "2024-10-01T00:00:00Z",
+    "pricePivot1Price": 100.5,
+    "pricePivot2Time": "2024-10-01T12:00:00Z",
+    "pricePivot2Price": 98,
+    "indicatorPivot1Time": "2024-10-01T04:00:00Z",
+    "indicatorPivot1Value": 25.25,
+    "indicatorPivot2Time": "2024-10-01T12:00:00Z",
+    "indicatorPivot2Value": 31,
+    "confirmationTime": "2024-10-01T20:00:00Z",
+    "score": 0.75
+  }
+]
+`},
+		{NDJSON, `{"symbol":"BTCUSDT","interval":"4h","type":"regular_bullish","kind":"regular","direction":"bullish","indicator":"RSI(14)","pricePivot1Time":"2024-10-01T00:00:00Z","pricePivot1Price":100.5,"pricePivot2Time":"2024-10-01T12:00:00Z","pricePivot2Price":98,"indicatorPivot1Time":"2024-10-01T04:00:00Z","indicatorPivot1Value":25.25,"indicatorPivot2Time":"2024-10-01T12:00:00Z","indicatorPivot2Value":31,"confirmationTime":"2024-10-01T20:00:00Z","score":0.75}
+{"symbol":"ETHUSDT","interval":"","type":"regular_bullish","kind":"regular","direction":"bullish","indicator":"RSI(14)","pricePivot1Time":"2024-10-01T00:00:00Z","pricePivot1Price":100.5,"pricePivot2Time":"2024-10-01T12:00:00Z","pricePivot2Price":98,"indicatorPivot1Time":"2024-10-01T04:00:00Z","indicatorPivot1Value":25.25,"indicatorPivot2Time":"2024-10-01T12:00:00Z","indicatorPivot2Value":31,"confirmationTime":"2024-10-01T20:00:00Z","score":0.75}
+`},
+		{CSV, `symbol,interval,type,kind,direction,indicator,pricePivot1Time,pricePivot1Price,pricePivot2Time,pricePivot2Price,indicatorPivot1Time,indicatorPivot1Value,indicatorPivot2Time,indicatorPivot2Value,confirmationTime,score
+BTCUSDT,4h,regular_bullish,regular,bullish,RSI(14),2024-10-01T00:00:00Z,100.5,2024-10-01T12:00:00Z,98,2024-10-01T04:00:00Z,25.25,2024-10-01T12:00:00Z,31,2024-10-01T20:00:00Z,0.75
+ETHUSDT,,regular_bullish,regular,bullish,RSI(14),2024-10-01T00:00:00Z,100.5,2024-10-01T12:00:00Z,98,2024-10-01T04:00:00Z,25.25,2024-10-01T12:00:00Z,31,2024-10-01T20:00:00Z,0.75
+`},
+	}
+	for _, test := range tests {
+		t.Run(string(test.format), func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Write(&out, test.format, testRecords()); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != test.want {
+				t.Errorf("got\n%s\nwant\n%s", out.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestWriteEmpty(t *testing.T) {
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{Text, ""},
+		// an empty array rather than null, so consumers can always iterate
+		{JSON, "[]\n"},
+		{NDJSON, ""},
+		{CSV, strings.Join(csvHeader, ",") + "\n"},
+	}
+	for _, test := range tests {
+		t.Run(string(test.format), func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Write(&out, test.format, nil); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != test.want {
+				t.Errorf("got %q, want %q", out.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestCSVHeaderMatchesJSON(t *testing.T) {
+	fields := reflect.TypeOf(Record{})
+	names := make([]string, fields.NumField())
+	for i := range names {
+		names[i] = fields.Field(i).Tag.Get("json")
+	}
+	if !reflect.DeepEqual(names, csvHeader) {
+		t.Errorf("JSON fields %v, CSV columns %v", names, csvHeader)
+	}
+	if row := testRecords()[0].csvRow(); len(row) != len(csvHeader) {
+		t.Errorf("got %d values for %d columns", len(row), len(csvHeader))
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, name := range []string{"text", "json", "ndjson", "csv"} {
+		if format, err := ParseFormat(name); err != nil || string(format) != name {
+			t.Errorf("%s: got %q, %v", name, format, err)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("no error for xml")
+	}
+	if err := Write(&bytes.Buffer{}, Format("xml"), testRecords()); err == nil {
+		t.Error("wrote xml")
+	}
+}
@@ -0,0 +1,163 @@
+package scan
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/divergence/pkg/feed"
+	"github.com/divergence/pkg/models"
+	"github.com/divergence/pkg/store"
+)
+
+// Job is the candles of one symbol on one interval
+type Job struct {
+	Symbol   string
+	Interval time.Duration
+	Source   feed.CandleSource
+}
+
+// Config lists the candle files to scan, it is read from JSON like
+//
+//	{"format": "bybit", "jobs": [{"symbol": "BTCUSDT", "interval": "4h", "path": "btc-4h.json"}]}
+type Config struct {
+	// Format is used for jobs without a format. Empty guesses it from the file extension
+	Format string      `json:"format"`
+	Jobs   []JobConfig `json:"jobs"`
+}
+
+type JobConfig struct {
+	Symbol   string `json:"symbol"`
+	Interval string `json:"interval"`
+	// Path is relative to the config file
+	Path   string `json:"path"`
+	Format string `json:"format"`
+}
+
+// LoadConfig reads the jobs of the config file at path
+func LoadConfig(path string) ([]Job, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	jobs := make([]Job, 0, len(config.Jobs))
+	for i, job := range config.Jobs {
+		if job.Symbol == "" || job.Path == "" {
+			return nil, fmt.Errorf("%s: job %d: symbol and path are required", path, i)
+		}
+		interval, err := models.ParseInterval(job.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("%s: job %d: %w", path, i, err)
+		}
+
+		file := job.Path
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(path), file)
+		}
+		format, err := formatOf(file, job.Format, config.Format)
+		if err != nil {
+			return nil, fmt.Errorf("%s: job %d: %w", path, i, err)
+		}
+
+		jobs = append(jobs, Job{
+			Symbol:   job.Symbol,
+			Interval: interval,
+			Source:   feed.FileSource{Path: file, Format: format, Interval: interval},
+		})
+	}
+	return jobs, nil
+}
+
+// JobsFromDir returns a job for every file in dir named <symbol>-<interval>.<extension>, like btc-4h.json.
+// An empty format guesses it from the extension, files that do not match are skipped
+func JobsFromDir(dir, format string) ([]Job, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := []Job{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		dash := strings.LastIndex(name, "-")
+		if dash <= 0 {
+			continue
+		}
+		interval, err := models.ParseInterval(name[dash+1:])
+		if err != nil {
+			continue
+		}
+
+		file := filepath.Join(dir, entry.Name())
+		fileFormat, err := formatOf(file, format, "")
+		if err != nil {
+			continue
+		}
+
+		jobs = append(jobs, Job{
+			Symbol:   strings.ToUpper(name[:dash]),
+			Interval: interval,
+			Source:   feed.FileSource{Path: file, Format: fileFormat, Interval: interval},
+		})
+	}
+
+	sortJobs(jobs)
+	return jobs, nil
+}
+
+// JobsFromStore returns a job for every key of s. A non-empty exchange only returns the keys of that
+// exchange. The jobs read from s, so it has to stay open until they are scanned
+func JobsFromStore(s *store.Store, exchange string) ([]Job, error) {
+	keys, err := s.Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := []Job{}
+	for _, key := range keys {
+		if exchange != "" && key.Exchange != exchange {
+			continue
+		}
+		jobs = append(jobs, Job{
+			Symbol:   key.Symbol,
+			Interval: key.Interval,
+			Source:   store.Source{Store: s, Key: key},
+		})
+	}
+
+	sortJobs(jobs)
+	return jobs, nil
+}
+
+// sortJobs orders jobs by symbol and interval
+func sortJobs(jobs []Job) {
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].Symbol != jobs[j].Symbol {
+			return jobs[i].Symbol < jobs[j].Symbol
+		}
+		return jobs[i].Interval < jobs[j].Interval
+	})
+}
+
+// formatOf returns the first format that is set, or guesses it from the extension of path
+func formatOf(path string, names ...string) (feed.Format, error) {
+	for _, name := range names {
+		if name != "" {
+			return feed.FormatByName(name)
+		}
+	}
+	return feed.FormatOf(path)
+}
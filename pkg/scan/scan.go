@@ -0,0 +1,274 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/divergence/pkg/models"
+	"github.com/divergence/pkg/ta/divergence_detection"
+)
+
+// Options holds the settings of a scan
+type Options struct {
+	// Detector is used on every job. Its Window is the number of most recent closed candles scanned, 0
+	// scans all candles
+	Detector divergence_detection.DetectorConfig
+	// Workers is the number of jobs run at the same time, 0 uses one per CPU
+	Workers int
+	// MaxAge is the number of bars since the confirmation up to which a divergence is current
+	MaxAge int
+	// Now drops candles that are still running at Now. A zero Now uses the current time
+	Now time.Time
+	// Confluence scans the intervals of a symbol together and only reports the divergences of the lower
+	// intervals that agree with a divergence on a higher one. Window then counts candles of the highest
+	// interval of the symbol
+	Confluence bool
+}
+
+// DefaultOptions scans the last 300 candles for divergences confirmed within the last 3 bars
+func DefaultOptions() Options {
+	detector := divergence_detection.DefaultDetectorConfig()
+	detector.Window = 300
+	return Options{Detector: detector, MaxAge: 3}
+}
+
+// Result is a current divergence of a symbol
+type Result struct {
+	Symbol     string
+	Interval   time.Duration
+	Divergence divergence_detection.Divergence
+	// Age is the number of bars since the divergence was confirmed, 0 on the last closed bar
+	Age int
+	// HigherInterval and Higher are the divergence on a higher interval the divergence agrees with, when
+	// scanned for confluences
+	HigherInterval time.Duration
+	Higher         divergence_detection.Divergence
+}
+
+// Scan runs the jobs on a bounded number of workers and returns the current divergences, the highest
+// score first. Jobs that fail do not stop the others, their errors are joined into the returned error
+func Scan(ctx context.Context, jobs []Job, options Options) ([]Result, error) {
+	if options.MaxAge < 0 {
+		return nil, fmt.Errorf("max age must be >= 0, got %d", options.MaxAge)
+	}
+	detector, err := divergence_detection.NewDetector(options.Detector)
+	if err != nil {
+		return nil, err
+	}
+	if options.Workers <= 0 {
+		options.Workers = runtime.NumCPU()
+	}
+	if options.Now.IsZero() {
+		options.Now = time.Now()
+	}
+
+	queue := make(chan []Job)
+	var mu sync.Mutex
+	var results []Result
+	var errs []error
+
+	var wg sync.WaitGroup
+	groups := groupJobs(jobs, options.Confluence)
+	for range min(options.Workers, max(len(groups), 1)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range queue {
+				var found []Result
+				var err error
+				if options.Confluence {
+					found, err = scanConfluences(detector, group, options)
+				} else {
+					found, err = scanJob(detector, group[0], options)
+				}
+
+				mu.Lock()
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", groupName(group, options.Confluence), err))
+				}
+				results = append(results, found...)
+				mu.Unlock()
+			}
+		}()
+	}
+
+enqueue:
+	for _, group := range groups {
+		select {
+		case queue <- group:
+		case <-ctx.Done():
+			break enqueue
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		errs = append(errs, ctx.Err())
+	}
+
+	Rank(results)
+	return results, errors.Join(errs...)
+}
+
+// groupJobs returns one group per job, or one per symbol holding all its jobs when the intervals of a
+// symbol are scanned together
+func groupJobs(jobs []Job, bySymbol bool) [][]Job {
+	groups := [][]Job{}
+	index := map[string]int{}
+	for _, job := range jobs {
+		i, ok := index[job.Symbol]
+		if !bySymbol || !ok {
+			index[job.Symbol] = len(groups)
+			groups = append(groups, []Job{job})
+			continue
+		}
+		groups[i] = append(groups[i], job)
+	}
+	return groups
+}
+
+// groupName names a group in errors, by its symbol and interval or by its symbol alone
+func groupName(group []Job, bySymbol bool) string {
+	if bySymbol {
+		return group[0].Symbol
+	}
+	return fmt.Sprintf("%s %s", group[0].Symbol, models.FormatInterval(group[0].Interval))
+}
+
+func scanJob(detector *divergence_detection.Detector, job Job, options Options) ([]Result, error) {
+	asset, err := closedCandles(job, options.Now)
+	if err != nil {
+		return nil, err
+	}
+
+	divergences, err := detector.DetectAsset(asset)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []Result{}
+	for _, divergence := range divergences {
+		age := asset.Len() - 1 - divergence.ConfirmationIndex
+		if age > options.MaxAge {
+			continue
+		}
+		results = append(results, Result{Symbol: job.Symbol, Interval: job.Interval, Divergence: divergence, Age: age})
+	}
+	return results, nil
+}
+
+// scanConfluences detects the divergences of the jobs of one symbol together and returns the current
+// divergences of the lower intervals that agree with one on a higher interval
+func scanConfluences(detector *divergence_detection.Detector, jobs []Job, options Options) ([]Result, error) {
+	timeframes := make([]divergence_detection.Timeframe, len(jobs))
+	lengths := map[time.Duration]int{}
+	for i, job := range jobs {
+		asset, err := closedCandles(job, options.Now)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", models.FormatInterval(job.Interval), err)
+		}
+		timeframes[i] = divergence_detection.Timeframe{Interval: job.Interval, Asset: asset}
+		lengths[job.Interval] = asset.Len()
+	}
+
+	found, err := detector.DetectMultiTimeframe(timeframes)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []Result{}
+	for _, confluence := range found.Confluences {
+		age := lengths[confluence.LowerInterval] - 1 - confluence.Lower.ConfirmationIndex
+		if age > options.MaxAge {
+			continue
+		}
+		results = append(results, Result{
+			Symbol:         jobs[0].Symbol,
+			Interval:       confluence.LowerInterval,
+			Divergence:     confluence.Lower,
+			Age:            age,
+			HigherInterval: confluence.HigherInterval,
+			Higher:         confluence.Higher,
+		})
+	}
+	return results, nil
+}
+
+// closedCandles reads the candles of job without the one still running at now
+func closedCandles(job Job, now time.Time) (models.Asset, error) {
+	candles, err := job.Source.Candles()
+	if err != nil {
+		return models.Asset{}, err
+	}
+	asset := models.AssetFromCandles(candles)
+	if asset.Interval == 0 {
+		asset.Interval = job.Interval
+	}
+
+	// the running candle would change the pivots once it closes
+	end := asset.Len()
+	for end > 0 && !asset.IsClosed(end-1, now) {
+		end--
+	}
+	return asset.Slice(0, end), nil
+}
+
+// Rank orders results by score, then the youngest first, then by symbol, interval and higher interval
+func Rank(results []Result) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		switch {
+		case a.Divergence.Score.Total != b.Divergence.Score.Total:
+			return a.Divergence.Score.Total > b.Divergence.Score.Total
+		case a.Age != b.Age:
+			return a.Age < b.Age
+		case a.Symbol != b.Symbol:
+			return a.Symbol < b.Symbol
+		case a.Interval != b.Interval:
+			return a.Interval < b.Interval
+		default:
+			return a.HigherInterval < b.HigherInterval
+		}
+	})
+}
+
+// WriteTable writes results as an aligned table. Confluences get a column with the divergence on the
+// higher interval
+func WriteTable(w io.Writer, results []Result) error {
+	confluence := false
+	for _, result := range results {
+		confluence = confluence || result.HigherInterval > 0
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := "RANK\tSYMBOL\tINTERVAL\tTYPE\tCONFIRMED\tAGE\tSCORE"
+	if confluence {
+		header += "\tHIGHER"
+	}
+	fmt.Fprintln(table, header)
+	for i, result := range results {
+		d := result.Divergence
+		fmt.Fprintf(table, "%d\t%s\t%s\t%s %s\t%s\t%d\t%.2f",
+			i+1,
+			result.Symbol,
+			models.FormatInterval(result.Interval),
+			d.Kind, d.Direction,
+			d.ConfirmationTime.UTC().Format("2006-01-02 15:04"),
+			result.Age,
+			d.Score.Total,
+		)
+		if confluence {
+			fmt.Fprintf(table, "\t%s %s %s", models.FormatInterval(result.HigherInterval), result.Higher.Kind, result.Higher.Direction)
+		}
+		fmt.Fprintln(table)
+	}
+	return table.Flush()
+}
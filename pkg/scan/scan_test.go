@@ -0,0 +1,238 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/divergence/pkg/feed"
+	"github.com/divergence/pkg/models"
+	"github.com/divergence/pkg/ta/divergence_detection"
+)
+
+// candleSource returns its candles, or its error
+type candleSource struct {
+	candles []*models.Candle
+	err     error
+}
+
+func (s candleSource) Candles() ([]*models.Candle, error) {
+	return s.candles, s.err
+}
+
+func loadCandles(t *testing.T) []*models.Candle {
+	t.Helper()
+	candles, err := feed.FileSource{Path: "../../data/btc-4h.json", Format: feed.BybitFormat{}}.Candles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return candles
+}
+
+func TestScanConfluence(t *testing.T) {
+	candles := loadCandles(t)
+	higher, err := models.Resample(candles, models.ResampleConfig{Interval: 12 * time.Hour, DropPartial: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := []Job{
+		{Symbol: "BTCUSDT", Interval: 4 * time.Hour, Source: candleSource{candles: candles}},
+		{Symbol: "BTCUSDT", Interval: 12 * time.Hour, Source: candleSource{candles: higher}},
+	}
+	options := DefaultOptions()
+	options.Confluence = true
+	options.MaxAge = 1000
+	options.Now = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	results, err := Scan(context.Background(), jobs, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the 4h low of 2024-11-04 20:00 lies within the 12h bar of the higher low of 2024-11-04 12:00
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	result := results[0]
+	if result.Interval != 4*time.Hour || result.HigherInterval != 12*time.Hour {
+		t.Errorf("got a %v divergence agreeing with %v, want 4h and 12h", result.Interval, result.HigherInterval)
+	}
+	if pivot := time.Date(2024, 11, 4, 20, 0, 0, 0, time.UTC); !result.Divergence.PricePivots[1].Time.Equal(pivot) {
+		t.Errorf("pivot at %v, want %v", result.Divergence.PricePivots[1].Time, pivot)
+	}
+	if want := len(candles) - 1 - result.Divergence.ConfirmationIndex; result.Age != want {
+		t.Errorf("age %d, want %d", result.Age, want)
+	}
+
+	// without confluence every divergence of both intervals is reported
+	options.Confluence = false
+	all, err := Scan(context.Background(), jobs, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) <= len(results) {
+		t.Errorf("got %d results without confluence, want more than %d", len(all), len(results))
+	}
+}
+
+func TestScan(t *testing.T) {
+	candles := loadCandles(t)
+	good := []Job{
+		{Symbol: "BTCUSDT", Interval: 4 * time.Hour, Source: candleSource{candles: candles}},
+		{Symbol: "ETHUSDT", Interval: 4 * time.Hour, Source: candleSource{candles: candles[:400]}},
+		{Symbol: "SOLUSDT", Interval: 4 * time.Hour, Source: candleSource{candles: candles[100:]}},
+	}
+	bad := []Job{
+		{Symbol: "BADUSDT", Interval: 4 * time.Hour, Source: candleSource{err: errors.New("connection reset")}},
+		{Symbol: "NEWUSDT", Interval: time.Hour, Source: candleSource{candles: candles[:10]}},
+	}
+	options := DefaultOptions()
+	options.MaxAge = 100
+	options.Workers = 2
+	options.Now = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	results, err := Scan(context.Background(), append(append([]Job{}, bad[0]), append(good, bad[1])...), options)
+	if err == nil {
+		t.Fatal("no error")
+	}
+	for _, want := range []string{"BADUSDT 4h: connection reset", "NEWUSDT 1h: need at least"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+
+	// the failed jobs do not change the results of the others
+	want, err := Scan(context.Background(), good, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("got %d results with failing jobs, want the %d of the good jobs", len(results), len(want))
+	}
+
+	symbols := map[string]bool{}
+	for i, result := range results {
+		symbols[result.Symbol] = true
+		if result.Age > options.MaxAge {
+			t.Errorf("%s confirmed %d bars ago, more than %d", result.Symbol, result.Age, options.MaxAge)
+		}
+		if i > 0 && ranksBefore(result, results[i-1]) {
+			t.Errorf("result %d (%v, age %d) ranks before result %d (%v, age %d)", i, result.Divergence.Score.Total, result.Age, i-1, results[i-1].Divergence.Score.Total, results[i-1].Age)
+		}
+	}
+	if len(symbols) != 3 {
+		t.Errorf("got results of %v, want all three good symbols", symbols)
+	}
+
+	// every worker count finds the same divergences
+	for _, workers := range []int{1, 8} {
+		options.Workers = workers
+		if got, err := Scan(context.Background(), good, options); err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%d workers: got %d results and error %v, want %d", workers, len(got), err, len(want))
+		}
+	}
+}
+
+func ranksBefore(a, b Result) bool {
+	results := []Result{b, a}
+	Rank(results)
+	return results[0] == a && a != b
+}
+
+func TestScanDropsRunningCandle(t *testing.T) {
+	candles := loadCandles(t)
+	options := DefaultOptions()
+	options.MaxAge = 100
+
+	// the last candle opened 2 hours before now and runs for 2 more
+	options.Now = candles[len(candles)-1].StartTime().Add(2 * time.Hour)
+	running, err := Scan(context.Background(), []Job{{Symbol: "BTCUSDT", Interval: 4 * time.Hour, Source: candleSource{candles: candles}}}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options.Now = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	closed, err := Scan(context.Background(), []Job{{Symbol: "BTCUSDT", Interval: 4 * time.Hour, Source: candleSource{candles: candles[:len(candles)-1]}}}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(closed) == 0 || !reflect.DeepEqual(running, closed) {
+		t.Errorf("got %d results with a running candle, want the %d without it", len(running), len(closed))
+	}
+}
+
+func TestScanCancelled(t *testing.T) {
+	candles := loadCandles(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	jobs := []Job{}
+	for _, symbol := range []string{"A", "B", "C", "D"} {
+		jobs = append(jobs, Job{Symbol: symbol, Interval: 4 * time.Hour, Source: candleSource{candles: candles}})
+	}
+	if _, err := Scan(ctx, jobs, DefaultOptions()); !errors.Is(err, context.Canceled) {
+		t.Errorf("error %v, want context.Canceled", err)
+	}
+}
+
+func TestRank(t *testing.T) {
+	result := func(symbol string, interval time.Duration, score float64, age int) Result {
+		r := Result{Symbol: symbol, Interval: interval, Age: age}
+		r.Divergence.Score.Total = score
+		return r
+	}
+	want := []Result{
+		result("ETHUSDT", 4*time.Hour, 0.9, 2),
+		result("BTCUSDT", 4*time.Hour, 0.8, 0),
+		result("BTCUSDT", time.Hour, 0.8, 1),
+		result("BTCUSDT", 4*time.Hour, 0.8, 1),
+		result("ETHUSDT", time.Hour, 0.8, 1),
+		result("ADAUSDT", time.Hour, 0.5, 0),
+	}
+	results := []Result{want[4], want[5], want[2], want[0], want[3], want[1]}
+	Rank(results)
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("got %v, want %v", results, want)
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	r := Result{Symbol: "BTCUSDT", Interval: 4 * time.Hour, Age: 1}
+	r.Divergence.Kind = divergence_detection.Regular
+	r.Divergence.Direction = divergence_detection.Bullish
+	r.Divergence.ConfirmationTime = time.Date(2024, 10, 1, 20, 0, 0, 0, time.UTC)
+	r.Divergence.Score.Total = 0.75
+
+	confluence := r
+	confluence.HigherInterval = 24 * time.Hour
+	confluence.Higher.Kind = divergence_detection.Hidden
+	confluence.Higher.Direction = divergence_detection.Bullish
+
+	tests := []struct {
+		name    string
+		results []Result
+		want    string
+	}{
+		{"empty", nil, "RANK  SYMBOL  INTERVAL  TYPE  CONFIRMED  AGE  SCORE\n"},
+		{"divergence", []Result{r}, `RANK  SYMBOL   INTERVAL  TYPE             CONFIRMED         AGE  SCORE
+1     BTCUSDT  4h        regular bullish  2024-10-01 20:00  1    0.75
+`},
+		// confluences add the divergence on the higher interval
+		{"confluence", []Result{confluence}, `RANK  SYMBOL   INTERVAL  TYPE             CONFIRMED         AGE  SCORE  HIGHER
+1     BTCUSDT  4h        regular bullish  2024-10-01 20:00  1    0.75   1d hidden bullish
+`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out strings.Builder
+			if err := WriteTable(&out, test.results); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != test.want {
+				t.Errorf("got\n%s\nwant\n%s", out.String(), test.want)
+			}
+		})
+	}
+}
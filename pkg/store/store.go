@@ -0,0 +1,299 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/divergence/pkg/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+var candlesBucket = []byte("candles")
+
+// ErrNotFound is returned by Delete when key holds no candles
+var ErrNotFound = errors.New("key not found")
+
+// Key identifies the candles of a symbol on one interval of an exchange
+type Key struct {
+	Exchange string
+	Symbol   string
+	Interval time.Duration
+}
+
+func (k Key) String() string {
+	return fmt.Sprintf("%s/%s/%s", k.Exchange, k.Symbol, models.FormatInterval(k.Interval))
+}
+
+func (k Key) validate() error {
+	if k.Exchange == "" || k.Symbol == "" {
+		return fmt.Errorf("key %v: exchange and symbol are required", k)
+	}
+	if strings.Contains(k.Exchange, "/") || strings.Contains(k.Symbol, "/") {
+		return fmt.Errorf("key %v: exchange and symbol must not contain '/'", k)
+	}
+	if k.Interval <= 0 {
+		return fmt.Errorf("key %v: interval must be > 0", k)
+	}
+	return nil
+}
+
+func parseKey(name string) (Key, error) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 3 {
+		return Key{}, fmt.Errorf("invalid key %q", name)
+	}
+	interval, err := models.ParseInterval(parts[2])
+	if err != nil {
+		return Key{}, fmt.Errorf("invalid key %q: %w", name, err)
+	}
+	return Key{Exchange: parts[0], Symbol: parts[1], Interval: interval}, nil
+}
+
+// Gap is a range of missing candles, From is the open time of the first missing candle and To the open
+// time of the next candle that is there
+type Gap struct {
+	From    time.Time
+	To      time.Time
+	Missing int
+}
+
+// Store keeps candles in a local file, one bucket per key with the candles ordered by open time
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens the store at path and creates it when it does not exist
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening store %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(candlesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Upsert writes candles under key. A candle replaces the stored one with the same open time, so writing
+// the same candles twice leaves the store unchanged
+func (s *Store) Upsert(key Key, candles []*models.Candle) error {
+	if err := key.validate(); err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(candlesBucket).CreateBucketIfNotExists([]byte(key.String()))
+		if err != nil {
+			return err
+		}
+
+		for _, candle := range candles {
+			stored := *candle
+			stored.SetInterval(key.Interval)
+
+			value, err := json.Marshal(stored)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(timeKey(candle.StartTime()), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Candles returns the candles of key that open from from up to, but not including, to, ordered from old
+// to new. A zero from or to leaves that side open
+func (s *Store) Candles(key Key, from, to time.Time) ([]*models.Candle, error) {
+	if err := key.validate(); err != nil {
+		return nil, err
+	}
+
+	candles := []*models.Candle{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return scan(tx, key, from, to, func(_ time.Time, value []byte) error {
+			candle := &models.Candle{}
+			if err := json.Unmarshal(value, candle); err != nil {
+				return fmt.Errorf("%v: %w", key, err)
+			}
+			candles = append(candles, candle)
+			return nil
+		})
+	})
+	return candles, err
+}
+
+// Asset returns the candles of key between from and to like Candles
+func (s *Store) Asset(key Key, from, to time.Time) (models.Asset, error) {
+	candles, err := s.Candles(key, from, to)
+	if err != nil {
+		return models.Asset{}, err
+	}
+
+	asset := models.AssetFromCandles(candles)
+	asset.Interval = key.Interval
+	return asset, nil
+}
+
+// Source reads the candles of Key between From and To from Store, so it can be used wherever a
+// feed.CandleSource is read
+type Source struct {
+	Store *Store
+	Key   Key
+	// From and To are passed to Candles, zero times leave that side open
+	From time.Time
+	To   time.Time
+}
+
+func (s Source) Candles() ([]*models.Candle, error) {
+	return s.Store.Candles(s.Key, s.From, s.To)
+}
+
+// Keys returns the keys that hold candles
+func (s *Store) Keys() ([]Key, error) {
+	keys := []Key{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(candlesBucket).ForEach(func(name, _ []byte) error {
+			key, err := parseKey(string(name))
+			if err != nil {
+				return err
+			}
+			keys = append(keys, key)
+			return nil
+		})
+	})
+	return keys, err
+}
+
+// Bounds returns the open times of the first and the last candle of key and the number of candles
+func (s *Store) Bounds(key Key) (time.Time, time.Time, int, error) {
+	if err := key.validate(); err != nil {
+		return time.Time{}, time.Time{}, 0, err
+	}
+
+	var first, last time.Time
+	count := 0
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(candlesBucket).Bucket([]byte(key.String()))
+		if bucket == nil {
+			return nil
+		}
+		count = bucket.Stats().KeyN
+		cursor := bucket.Cursor()
+		if k, _ := cursor.First(); k != nil {
+			first = keyTime(k)
+		}
+		if k, _ := cursor.Last(); k != nil {
+			last = keyTime(k)
+		}
+		return nil
+	})
+	return first, last, count, err
+}
+
+// Gaps returns the ranges of missing candles of key between from and to. A zero from or to only reports
+// the gaps between the stored candles on that side, a store without candles of key is one gap
+func (s *Store) Gaps(key Key, from, to time.Time) ([]Gap, error) {
+	if err := key.validate(); err != nil {
+		return nil, err
+	}
+
+	gaps := []Gap{}
+	add := func(start, end time.Time) {
+		if missing := int(end.Sub(start) / key.Interval); missing > 0 {
+			gaps = append(gaps, Gap{From: start, To: end, Missing: missing})
+		}
+	}
+
+	var previous time.Time
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return scan(tx, key, from, to, func(t time.Time, _ []byte) error {
+			switch {
+			case !previous.IsZero():
+				add(previous.Add(key.Interval), t)
+			case !from.IsZero():
+				add(from, t)
+			}
+			previous = t
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case to.IsZero():
+	case !previous.IsZero():
+		add(previous.Add(key.Interval), to)
+	case !from.IsZero():
+		add(from, to)
+	}
+	return gaps, nil
+}
+
+// scan calls f with the open time and the value of every candle of key from from up to to
+func scan(tx *bolt.Tx, key Key, from, to time.Time, f func(t time.Time, value []byte) error) error {
+	bucket := tx.Bucket(candlesBucket).Bucket([]byte(key.String()))
+	if bucket == nil {
+		return nil
+	}
+
+	cursor := bucket.Cursor()
+	k, v := cursor.First()
+	if !from.IsZero() {
+		k, v = cursor.Seek(timeKey(from))
+	}
+	for ; k != nil; k, v = cursor.Next() {
+		t := keyTime(k)
+		if !to.IsZero() && !t.Before(to) {
+			break
+		}
+		if err := f(t, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// timeKey encodes the open time in milliseconds so the keys sort by time
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixMilli()))
+	return key
+}
+
+func keyTime(key []byte) time.Time {
+	return time.UnixMilli(int64(binary.BigEndian.Uint64(key)))
+}
+
+// Delete removes all candles of key
+func (s *Store) Delete(key Key) error {
+	if err := key.validate(); err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(candlesBucket).DeleteBucket([]byte(key.String()))
+		if errors.Is(err, bolt.ErrBucketNotFound) {
+			return fmt.Errorf("%v: %w", key, ErrNotFound)
+		}
+		return err
+	})
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/divergence/pkg/exchange/exchangetest"
+	"github.com/divergence/pkg/models"
+)
+
+func TestSource(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "candles.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	key := Key{Exchange: "bybit", Symbol: "BTCUSDT", Interval: 4 * time.Hour}
+	other := Key{Exchange: "bybit", Symbol: "ETHUSDT", Interval: 4 * time.Hour}
+	if err := s.Upsert(key, exchangetest.Candles(20, 4*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Upsert(other, exchangetest.Candles(5, 4*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(i int) time.Time { return exchangetest.Start.Add(time.Duration(i) * 4 * time.Hour) }
+	tests := []struct {
+		name       string
+		key        Key
+		from, to   time.Time
+		first, len int
+	}{
+		{"all", key, time.Time{}, time.Time{}, 0, 20},
+		{"range", key, at(5), at(12), 5, 7},
+		{"from", key, at(15), time.Time{}, 15, 5},
+		{"to", key, time.Time{}, at(3), 0, 3},
+		{"other key", other, time.Time{}, time.Time{}, 0, 5},
+		{"missing key", Key{Exchange: "bybit", Symbol: "SOLUSDT", Interval: time.Hour}, time.Time{}, time.Time{}, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			candles, err := Source{Store: s, Key: test.key, From: test.from, To: test.to}.Candles()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(candles) != test.len {
+				t.Fatalf("got %d candles, want %d", len(candles), test.len)
+			}
+			for i, candle := range candles {
+				if want := at(test.first + i); !candle.StartTime().Equal(want) {
+					t.Fatalf("candle %d opens at %v, want %v", i, candle.StartTime(), want)
+				}
+				if candle.Interval != test.key.Interval {
+					t.Fatalf("candle %d has interval %v", i, candle.Interval)
+				}
+			}
+		})
+	}
+}
+
+// testStore returns a store holding candles 0 to 4, 7, 10 and 11 of exchangetest.Candles under key
+func testStore(t *testing.T, key Key) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "candles.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	candles := exchangetest.Candles(12, key.Interval)
+	stored := append(append(candles[:5:5], candles[7]), candles[10:]...)
+	if err := s.Upsert(key, stored); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestGaps(t *testing.T) {
+	key := Key{Exchange: "bybit", Symbol: "BTCUSDT", Interval: 4 * time.Hour}
+	s := testStore(t, key)
+
+	at := func(i int) time.Time { return exchangetest.Start.Add(time.Duration(i) * 4 * time.Hour) }
+	gap := func(from, to int) Gap { return Gap{From: at(from), To: at(to), Missing: to - from} }
+	tests := []struct {
+		name     string
+		key      Key
+		from, to time.Time
+		want     []Gap
+	}{
+		{"closed", key, at(0), at(15), []Gap{gap(5, 7), gap(8, 10), gap(12, 15)}},
+		{"before the first candle", key, at(-2), at(3), []Gap{gap(-2, 0)}},
+		{"from inside a gap", key, at(6), at(11), []Gap{gap(6, 7), gap(8, 10)}},
+		{"to inside a gap", key, at(1), at(9), []Gap{gap(5, 7), gap(8, 9)}},
+		{"open", key, time.Time{}, time.Time{}, []Gap{gap(5, 7), gap(8, 10)}},
+		{"open from", key, time.Time{}, at(13), []Gap{gap(5, 7), gap(8, 10), gap(12, 13)}},
+		{"open to", key, at(6), time.Time{}, []Gap{gap(6, 7), gap(8, 10)}},
+		{"no gaps", key, at(0), at(5), []Gap{}},
+		{"missing key", Key{Exchange: "bybit", Symbol: "ETHUSDT", Interval: 4 * time.Hour}, at(0), at(3), []Gap{gap(0, 3)}},
+		{"missing key open", Key{Exchange: "bybit", Symbol: "ETHUSDT", Interval: 4 * time.Hour}, time.Time{}, time.Time{}, []Gap{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gaps, err := s.Gaps(test.key, test.from, test.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(gaps) != len(test.want) {
+				t.Fatalf("got %v, want %v", gaps, test.want)
+			}
+			for i, gap := range gaps {
+				want := test.want[i]
+				if !gap.From.Equal(want.From) || !gap.To.Equal(want.To) || gap.Missing != want.Missing {
+					t.Errorf("gap %d is %v, want %v", i, gap, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBounds(t *testing.T) {
+	key := Key{Exchange: "bybit", Symbol: "BTCUSDT", Interval: 4 * time.Hour}
+	s := testStore(t, key)
+
+	first, last, count, err := s.Bounds(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.Equal(exchangetest.Start) || !last.Equal(exchangetest.Start.Add(11*4*time.Hour)) || count != 8 {
+		t.Errorf("got %v to %v with %d candles, want %v to %v with 8", first, last, count, exchangetest.Start, exchangetest.Start.Add(11*4*time.Hour))
+	}
+
+	first, last, count, err = s.Bounds(Key{Exchange: "bybit", Symbol: "ETHUSDT", Interval: 4 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.IsZero() || !last.IsZero() || count != 0 {
+		t.Errorf("a missing key got %v to %v with %d candles", first, last, count)
+	}
+}
+
+func TestUpsertTwice(t *testing.T) {
+	key := Key{Exchange: "bybit", Symbol: "BTCUSDT", Interval: time.Hour}
+	s := testStore(t, key)
+	before, err := s.Candles(key, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	candles := exchangetest.Candles(12, time.Hour)
+	if err := s.Upsert(key, candles[:5]); err != nil {
+		t.Fatal(err)
+	}
+	after, err := s.Candles(key, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("writing the same candles again changed the store")
+	}
+
+	// a candle with the same open time replaces the stored one and fills the gaps
+	changed := *candles[1]
+	changed.Close = 50
+	if err := s.Upsert(key, []*models.Candle{&changed, candles[5], candles[6]}); err != nil {
+		t.Fatal(err)
+	}
+	asset, err := s.Asset(key, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asset.Len() != 10 || asset.Closing[1] != 50 || asset.Interval != time.Hour {
+		t.Errorf("got %d candles with the second closing at %v and interval %v, want 10, 50 and 1h", asset.Len(), asset.Closing[1], asset.Interval)
+	}
+	if gaps, err := s.Gaps(key, time.Time{}, time.Time{}); err != nil || len(gaps) != 1 {
+		t.Errorf("got gaps %v and error %v, want the one of candles 8 and 9", gaps, err)
+	}
+}
@@ -0,0 +1,79 @@
+package divergence_detection
+
+import "sort"
+
+// alignPivots pairs both price pivots with the nearest indicator pivot that is at most tolerance bars away.
+// It returns the positions of the paired pivots in candidates, which has to be sorted
+func alignPivots(price [2]int, candidates []int, tolerance int) ([2]int, bool) {
+	var positions [2]int
+	for n, index := range price {
+		position, ok := nearestPivot(index, candidates, tolerance)
+		if !ok {
+			return positions, false
+		}
+		positions[n] = position
+	}
+
+	// both price pivots were paired with the same indicator pivot
+	if positions[0] >= positions[1] {
+		return positions, false
+	}
+
+	return positions, true
+}
+
+// nearestPivot prefers the earlier pivot when two are equally far away
+func nearestPivot(index int, candidates []int, tolerance int) (int, bool) {
+	position := sort.SearchInts(candidates, index-tolerance)
+	best, found := 0, false
+
+	for ; position < len(candidates) && candidates[position] <= index+tolerance; position++ {
+		if !found || abs(candidates[position]-index) < abs(candidates[best]-index) {
+			best, found = position, true
+		}
+	}
+
+	return best, found
+}
+
+// trendOf returns 1 when the second value is higher, -1 when it is lower and 0 when both are equal
+func trendOf(first, second float64) int {
+	if second > first {
+		return 1
+	}
+	if second < first {
+		return -1
+	}
+	return 0
+}
+
+// classify returns the divergence formed by the trends of the price and indicator pivots
+func classify(lows bool, priceTrend, indicatorTrend int) (Kind, Direction, bool) {
+	if lows {
+		if priceTrend == -1 && indicatorTrend == 1 {
+			// long
+			return Regular, Bullish, true
+		}
+		if priceTrend == 1 && indicatorTrend == -1 {
+			return Hidden, Bullish, true
+		}
+		return 0, 0, false
+	}
+
+	if priceTrend == -1 && indicatorTrend == 1 {
+		// hidden bearish
+		return Hidden, Bearish, true
+	}
+	if priceTrend == 1 && indicatorTrend == -1 {
+		// regular bearish
+		return Regular, Bearish, true
+	}
+	return 0, 0, false
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
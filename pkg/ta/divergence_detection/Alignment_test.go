@@ -0,0 +1,90 @@
+package divergence_detection
+
+import "testing"
+
+func TestNearestPivot(t *testing.T) {
+	candidates := []int{10, 14, 20, 26}
+
+	tests := []struct {
+		name             string
+		index, tolerance int
+		position         int
+		ok               bool
+	}{
+		{"exactly on a pivot", 14, 0, 1, true},
+		{"within the tolerance", 13, 2, 1, true},
+		{"at the tolerance", 23, 3, 2, true},
+		{"beyond the tolerance", 23, 2, 0, false},
+		{"tie prefers the earlier pivot", 12, 2, 0, true},
+		{"tie at the tolerance", 17, 3, 1, true},
+		{"before the first pivot", 5, 5, 0, true},
+		{"too far before the first pivot", 4, 5, 0, false},
+		{"after the last pivot", 30, 4, 3, true},
+		{"too far after the last pivot", 31, 4, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			position, ok := nearestPivot(test.index, candidates, test.tolerance)
+			if ok != test.ok || ok && position != test.position {
+				t.Errorf("got %d, %v, want %d, %v", position, ok, test.position, test.ok)
+			}
+		})
+	}
+
+	if _, ok := nearestPivot(10, nil, 5); ok {
+		t.Error("found a pivot without candidates")
+	}
+}
+
+func TestAlignPivots(t *testing.T) {
+	candidates := []int{10, 14, 20, 26}
+
+	tests := []struct {
+		name      string
+		price     [2]int
+		tolerance int
+		positions [2]int
+		ok        bool
+	}{
+		{"exactly on the pivots", [2]int{10, 20}, 0, [2]int{0, 2}, true},
+		{"within the tolerance", [2]int{12, 19}, 2, [2]int{0, 2}, true},
+		{"at the tolerance", [2]int{10, 23}, 3, [2]int{0, 2}, true},
+		{"second pivot beyond the tolerance", [2]int{10, 23}, 2, [2]int{}, false},
+		{"first pivot beyond the tolerance", [2]int{7, 20}, 2, [2]int{}, false},
+		{"both on the same indicator pivot", [2]int{15, 17}, 3, [2]int{}, false},
+		{"without tolerance", [2]int{11, 20}, 0, [2]int{}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			positions, ok := alignPivots(test.price, candidates, test.tolerance)
+			if ok != test.ok || ok && positions != test.positions {
+				t.Errorf("got %v, %v, want %v, %v", positions, ok, test.positions, test.ok)
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		lows                       bool
+		priceTrend, indicatorTrend int
+		kind                       Kind
+		direction                  Direction
+		ok                         bool
+	}{
+		{true, -1, 1, Regular, Bullish, true},
+		{true, 1, -1, Hidden, Bullish, true},
+		{false, 1, -1, Regular, Bearish, true},
+		{false, -1, 1, Hidden, Bearish, true},
+		{true, -1, -1, 0, 0, false},
+		{false, 1, 1, 0, 0, false},
+		{true, 0, 1, 0, 0, false},
+		{false, 1, 0, 0, 0, false},
+	}
+	for _, test := range tests {
+		kind, direction, ok := classify(test.lows, test.priceTrend, test.indicatorTrend)
+		if ok != test.ok || ok && (kind != test.kind || direction != test.direction) {
+			t.Errorf("lows %v, price %d, indicator %d: got %v %v %v, want %v %v %v", test.lows, test.priceTrend, test.indicatorTrend, kind, direction, ok, test.kind, test.direction, test.ok)
+		}
+	}
+}
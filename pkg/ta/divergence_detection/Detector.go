@@ -0,0 +1,118 @@
+package divergence_detection
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/divergence/pkg/models"
+)
+
+// Detector finds divergences between price and an oscillator
+type Detector struct {
+	config DetectorConfig
+}
+
+// NewDetector returns an error instead of a Detector when config is invalid
+func NewDetector(config DetectorConfig) (*Detector, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid detector config: %w", err)
+	}
+
+	return &Detector{config: config}, nil
+}
+
+func (d *Detector) Config() DetectorConfig {
+	return d.config
+}
+
+// Detect returns the divergences between the closing prices and the RSI. candleClose has to be ordered from old to new
+func (d *Detector) Detect(candleClose []float64, dates []time.Time) ([]Divergence, error) {
+	if len(candleClose) != len(dates) {
+		return nil, fmt.Errorf("got %d closing prices but %d dates", len(candleClose), len(dates))
+	}
+
+	return d.DetectAsset(models.Asset{Closing: candleClose, Date: dates})
+}
+
+// DetectAsset returns the divergences between the prices of asset and the configured oscillator, within
+// the newest Window candles
+func (d *Detector) DetectAsset(asset models.Asset) ([]Divergence, error) {
+	if len(asset.Closing) != len(asset.Date) {
+		return nil, fmt.Errorf("got %d closing prices but %d dates", len(asset.Closing), len(asset.Date))
+	}
+
+	offset := 0
+	if d.config.Window > 0 && asset.Len() > d.config.Window {
+		offset = asset.Len() - d.config.Window
+		asset = asset.Slice(offset, asset.Len())
+	}
+
+	if asset.Len() < d.config.MinCandles() {
+		return nil, fmt.Errorf("need at least %d candles, got %d", d.config.MinCandles(), asset.Len())
+	}
+
+	indicator, err := d.config.Oscillator.Compute(asset)
+	if err != nil {
+		return nil, err
+	}
+
+	highs, lows, err := d.priceSeries(asset)
+	if err != nil {
+		return nil, err
+	}
+
+	start := 0
+	if d.config.TrimWarmUp {
+		start = d.config.Oscillator.WarmUp()
+	}
+
+	found := findDivergences(highs[start:], lows[start:], indicator[start:], asset.Date[start:], d.config.Order, d.config.ChainLength, d.config.AlignmentTolerance)
+
+	divergences := []Divergence{}
+	for _, divergence := range found {
+		prices := lows[start:]
+		if divergence.Direction == Bearish {
+			prices = highs[start:]
+		}
+		if d.config.CleanLines && !hasCleanLines(divergence, prices, indicator[start:], 0, d.config.LineTolerance) {
+			continue
+		}
+
+		divergence.Score = scoreDivergence(divergence, prices, indicator[start:], 0, d.config.Order, d.config.Oscillator, d.config.Score)
+		if divergence.Score.Total < d.config.MinScore {
+			continue
+		}
+
+		divergence.Indicator = d.config.Oscillator.Name()
+		divergence.Shift(offset + start)
+		divergences = append(divergences, divergence)
+	}
+
+	return divergences, nil
+}
+
+// priceSeries returns the series swing highs and swing lows are searched in
+func (d *Detector) priceSeries(asset models.Asset) ([]float64, []float64, error) {
+	if d.config.PriceMode == ClosePrice {
+		return asset.Closing, asset.Closing, nil
+	}
+
+	if d.config.PriceMode == WickPrice {
+		if len(asset.High) != asset.Len() || len(asset.Low) != asset.Len() {
+			return nil, nil, fmt.Errorf("%s prices need highs and lows for all %d candles", d.config.PriceMode, asset.Len())
+		}
+		return asset.High, asset.Low, nil
+	}
+
+	if len(asset.Opening) != asset.Len() {
+		return nil, nil, fmt.Errorf("%s prices need opening prices for all %d candles", d.config.PriceMode, asset.Len())
+	}
+	highs := make([]float64, asset.Len())
+	lows := make([]float64, asset.Len())
+	for i := range asset.Closing {
+		highs[i] = math.Max(asset.Opening[i], asset.Closing[i])
+		lows[i] = math.Min(asset.Opening[i], asset.Closing[i])
+	}
+	return highs, lows, nil
+}
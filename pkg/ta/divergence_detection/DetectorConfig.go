@@ -0,0 +1,112 @@
+package divergence_detection
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PriceMode selects the prices swing highs and lows are taken from
+type PriceMode int
+
+const (
+	// ClosePrice uses the closing price for both highs and lows
+	ClosePrice PriceMode = iota
+	// WickPrice uses the high for swing highs and the low for swing lows
+	WickPrice
+	// BodyPrice uses the top of the candle body for swing highs and the bottom for swing lows
+	BodyPrice
+)
+
+func (m PriceMode) String() string {
+	switch m {
+	case ClosePrice:
+		return "close"
+	case WickPrice:
+		return "wick"
+	case BodyPrice:
+		return "body"
+	default:
+		return fmt.Sprintf("price mode(%d)", int(m))
+	}
+}
+
+// DetectorConfig holds the settings of a Detector
+type DetectorConfig struct {
+	// Window is the number of newest candles that are scanned, 0 scans all candles. The indices of the
+	// divergences still count from the first candle of the asset
+	Window int
+	// Order is the number of bars on each side a pivot has to exceed
+	Order int
+	// ChainLength (K) is the number of consecutive higher or lower pivots that form a trend
+	ChainLength int
+	// AlignmentTolerance is the number of bars a price pivot and its indicator pivot may be apart
+	AlignmentTolerance int
+	// PriceMode selects the prices the pivots are taken from
+	PriceMode PriceMode
+	// Oscillator is the indicator price is compared against
+	Oscillator Oscillator
+	// Score weights the components of the divergence score
+	Score ScoreConfig
+	// MinScore drops divergences with a lower total score
+	MinScore float64
+	// CleanLines drops divergences where a bar between the pivots crosses the line connecting them,
+	// in price or in the indicator
+	CleanLines bool
+	// LineTolerance is the fraction of the range between the pivots a bar may cross the line by
+	LineTolerance float64
+	// TrimWarmUp ignores pivots within the oscillator warm-up, where it has no values yet
+	TrimWarmUp bool
+}
+
+// DefaultDetectorConfig returns the settings the detector has been tuned with on the 4h BTC/USDT data
+func DefaultDetectorConfig() DetectorConfig {
+	return DetectorConfig{
+		Order:       4,
+		ChainLength: 2,
+		Oscillator:  RSI{Period: 14},
+		Score:       DefaultScoreConfig(),
+		TrimWarmUp:  true,
+	}
+}
+
+// Validate returns an error describing the first invalid setting
+func (c DetectorConfig) Validate() error {
+	if c.Order < 1 {
+		return fmt.Errorf("order must be >= 1, got %d", c.Order)
+	}
+	if c.ChainLength < 2 {
+		return fmt.Errorf("chain length must be >= 2, got %d", c.ChainLength)
+	}
+	if c.AlignmentTolerance < 0 {
+		return fmt.Errorf("alignment tolerance must be >= 0, got %d", c.AlignmentTolerance)
+	}
+	if c.PriceMode < ClosePrice || c.PriceMode > BodyPrice {
+		return fmt.Errorf("unknown price mode %d", int(c.PriceMode))
+	}
+	if c.Oscillator == nil {
+		return errors.New("no oscillator set")
+	}
+	if err := c.Score.validate(c.Order); err != nil {
+		return err
+	}
+	if c.MinScore < 0 || c.MinScore > 1 {
+		return fmt.Errorf("min score must be between 0 and 1, got %v", c.MinScore)
+	}
+	if c.LineTolerance < 0 {
+		return fmt.Errorf("line tolerance must be >= 0, got %v", c.LineTolerance)
+	}
+	if c.Window < 0 {
+		return fmt.Errorf("window must be >= 0, got %d", c.Window)
+	}
+	if c.Window > 0 && c.Window < c.MinCandles() {
+		return fmt.Errorf("window of %d candles is smaller than the %d candles needed", c.Window, c.MinCandles())
+	}
+
+	return nil
+}
+
+// MinCandles is the smallest number of candles on which a divergence can be found
+func (c DetectorConfig) MinCandles() int {
+	// the oscillator warm-up plus two pivots with order bars on each side, and the bars to wait for the indicator pivot
+	return c.Oscillator.WarmUp() + 2*(2*c.Order+1) + c.AlignmentTolerance
+}
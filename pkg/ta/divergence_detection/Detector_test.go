@@ -0,0 +1,45 @@
+package divergence_detection
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/divergence/pkg/models"
+)
+
+func TestDetectorWindow(t *testing.T) {
+	asset := models.AssetFromCandles(loadCandles(t))
+	detect := func(asset models.Asset, window int) []Divergence {
+		t.Helper()
+		config := DefaultDetectorConfig()
+		config.Window = window
+		detector, err := NewDetector(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		divergences, err := detector.DetectAsset(asset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return divergences
+	}
+
+	// the window scans the newest candles, the indices still count from the first candle of the asset
+	offset := asset.Len() - 150
+	want := detect(asset.Slice(offset, asset.Len()), 0)
+	if len(want) == 0 {
+		t.Fatal("no divergences in the newest 150 candles")
+	}
+	for i := range want {
+		want[i].Shift(offset)
+	}
+	if got := detect(asset, 150); !reflect.DeepEqual(got, want) {
+		t.Errorf("a window of 150 found %v, want %v", got, want)
+	}
+
+	// an asset shorter than the window is scanned as a whole
+	short := asset.Slice(0, 100)
+	if got, want := detect(short, 150), detect(short, 0); !reflect.DeepEqual(got, want) {
+		t.Errorf("a window longer than the asset found %v, want %v", got, want)
+	}
+}
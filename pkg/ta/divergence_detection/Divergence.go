@@ -0,0 +1,91 @@
+package divergence_detection
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Kind tells if a divergence signals a reversal (regular) or a continuation (hidden)
+type Kind int
+
+const (
+	Regular Kind = iota
+	Hidden
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Regular:
+		return "regular"
+	case Hidden:
+		return "hidden"
+	default:
+		return fmt.Sprintf("kind(%d)", int(k))
+	}
+}
+
+// Direction tells in which direction price is expected to move after the divergence
+type Direction int
+
+const (
+	Bullish Direction = iota
+	Bearish
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Bullish:
+		return "bullish"
+	case Bearish:
+		return "bearish"
+	default:
+		return fmt.Sprintf("direction(%d)", int(d))
+	}
+}
+
+// Pivot is a local high or low of a series
+type Pivot struct {
+	Index int
+	Time  time.Time
+	Value float64
+}
+
+// Divergence between price and an indicator. The first pivot of each pair is the older one.
+type Divergence struct {
+	Kind      Kind
+	Direction Direction
+	// Indicator is the name of the oscillator
+	Indicator string
+
+	PricePivots     [2]Pivot
+	IndicatorPivots [2]Pivot
+	// Offsets is the number of bars each indicator pivot lies after its price pivot, negative when it lies before
+	Offsets [2]int
+
+	Score Score
+
+	// ConfirmationIndex is the first bar on which all pivots are known, order plus the alignment tolerance
+	// bars after the second price pivot
+	ConfirmationIndex int
+	ConfirmationTime  time.Time
+}
+
+// Type names the kind and direction of d, like hidden_bullish
+func (d Divergence) Type() string {
+	return fmt.Sprintf("%s_%s", d.Kind, d.Direction)
+}
+
+func (d Divergence) String() string {
+	kind := d.Kind.String()
+	return fmt.Sprintf("%s%s %s divergence: %v", strings.ToUpper(kind[:1]), kind[1:], d.Direction, d.ConfirmationTime)
+}
+
+// Shift moves all indices by n bars, used when the divergence was found on a sub slice
+func (d *Divergence) Shift(n int) {
+	for i := range d.PricePivots {
+		d.PricePivots[i].Index += n
+		d.IndicatorPivots[i].Index += n
+	}
+	d.ConfirmationIndex += n
+}
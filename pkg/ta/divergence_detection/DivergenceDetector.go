@@ -1,328 +1,151 @@
 package divergence_detection
 
 import (
-	"fmt"
-	"image/color"
-	"log"
 	"time"
 
 	"github.com/divergence/pkg/logger"
-	"github.com/markcheno/go-talib"
-
-	"gonum.org/v1/plot"
-	"gonum.org/v1/plot/plotter"
-	"gonum.org/v1/plot/vg"
 )
 
-func CalcDivergence(candleClose []float64, dates []time.Time) int {
-	var tempCandleClose []float64
-	var tempCandleDates []time.Time
-	
-	tempCandleClose = make([]float64, len(candleClose))
-	tempCandleDates = make([]time.Time, len(candleClose))
-
-	// we want to move the candleClose and dates to a variable where we can specify the length
-	// lets select the first 50 candles for smaller sample set
-	tempCandleClose = candleClose[0:80]
-	tempCandleDates = dates[0:80]
-
-	rsi := talib.Rsi(tempCandleClose, 14)
-
-	order := 4
-
-	// remove the first 14 elements from the array, because we don't have RSI values for them
-	plotLocalHighsAndLows(tempCandleClose[14:], tempCandleDates[14:], order)
-	
-	plotDivergence2(tempCandleClose[14:], tempCandleDates[14:], "trend_lines_price", order)
-
-	plotDivergence2(rsi[14:], tempCandleDates[14:], "trend_lines_rsi", order)
-
-	dataPeaks := getPeaks(tempCandleClose, order, 2)
-	rsiPeaks := getPeaks(rsi, order, 2)
-
-	divergences := []string{}
-
-	for i := 0; i < len(dataPeaks["lows"]); i++ {
-		if dataPeaks["lows"][i] == -1 && rsiPeaks["lows"][i] == 1 {
-			// long
-			//logger.Debugf("Regular bullish divergence: %v", tempCandleDates[i])
-			divergences = append(divergences, fmt.Sprintf("Regular bullish divergence: %v", tempCandleDates[i]))
-		}
-
-		if dataPeaks["lows"][i] == 1 && rsiPeaks["lows"][i] == -1 {
-			//logger.Debug("Hidden bullis divergence: ", tempCandleDates[i])
-			divergences = append(divergences, fmt.Sprintf("Hidden bullish divergence: %v", tempCandleDates[i]))
-		}
-
-		if dataPeaks["highs"][i] == -1 && rsiPeaks["highs"][i] == 1 {
-			// hidden bearish
-			//logger.Debug("Hidden bearish divergence: ", tempCandleDates[i])
-			divergences = append(divergences, fmt.Sprintf("Hidden bearish divergence: %v", tempCandleDates[i]))
-		}
-
-		if dataPeaks["highs"][i] == 1 && rsiPeaks["highs"][i] == -1 {
-			// regular bearish
-			//logger.Debug("Regular bearish divergence: ", tempCandleDates[i])
-			divergences = append(divergences, fmt.Sprintf("Regular bearish divergence: %v", tempCandleDates[i]))
-		}
-	}
-
-	logger.Debugf("Divergences: %v", divergences)
-
-	return 0
-}
-
-func plotDivergence2(data []float64, dates []time.Time, title string, order int) {
-	p := plot.New()
-
-	p.Title.Text = title
-	p.X.Label.Text = "Date"
-	p.Y.Label.Text = "Price ($)"
-
-	// Plot the close prices
-	ptsClose := make(plotter.XYs, len(data))
-	for i := range data {
-		ptsClose[i].X = float64(i)
-		ptsClose[i].Y = data[i]
-	}
-	lineClose, err := plotter.NewLine(ptsClose)
+// CalcDivergence detects divergences with the default settings. PlotDivergences draws their charts
+func CalcDivergence(candleClose []float64, dates []time.Time) ([]Divergence, error) {
+	detector, err := NewDetector(DefaultDetectorConfig())
 	if err != nil {
-		log.Fatal(err)
-	}
-	lineClose.Color = color.RGBA{0, 0, 0, 255}
-	p.Add(lineClose)
-
-	// Define colors for different divergence points
-	colors := []color.Color{
-		color.RGBA{0, 0, 0, 255},     // Close
-		color.RGBA{255, 0, 0, 255},   // Higher Highs
-		color.RGBA{0, 255, 0, 255},   // Higher Lows
-		color.RGBA{0, 0, 255, 255},   // Lower Lows
-		color.RGBA{255, 0, 255, 255}, // Lower Highs
+		return nil, err
 	}
 
-	hh := getHigherHighs(data, order, 2)
-	hl := getHigherLows(data, order, 2)
-	ll := getLowerLows(data, order, 2)
-	lh := getLowerHighs(data, order, 2)
-
-	// Plot different divergence points
-	plotDivergence(p, hh, dates, data, colors[1])
-	plotDivergence(p, hl, dates, data, colors[2])
-	plotDivergence(p, ll, dates, data, colors[3])
-	plotDivergence(p, lh, dates, data, colors[4])
-
-	// Add a legend
-	p.Legend.Add("Close", lineClose)
-
-	// Save the plot to a file or display it
-	if err := p.Save(6*vg.Inch, 4*vg.Inch, fmt.Sprintf("%s.png", title)); err != nil {
-		log.Fatal(err)
-	}
-
-	fmt.Println("Plot saved as divergence.png")
+	return detector.Detect(candleClose, dates)
 }
 
-func plotRsi(data []float64, dates []time.Time) {
-	p := plot.New()
-
-	p.Title.Text = "RSI"
-	p.X.Label.Text = "Date"
-	p.Y.Label.Text = "RSI"
-
-	rsi := talib.Rsi(data, 14)
-
-	ptsRsi := make(plotter.XYs, len(rsi))
-	for i := range rsi {
-		ptsRsi[i].X = float64(i)
-		ptsRsi[i].Y = rsi[i]
-	}
-
-	lineRsi, err := plotter.NewLine(ptsRsi)
-	if err != nil {
-		log.Fatal(err)
-	}
-	lineRsi.Color = color.RGBA{0, 0, 0, 255}
-	p.Add(lineRsi)
+// findDivergences pairs every chain of price pivots with the nearest indicator pivots and compares their trends.
+// Swing highs are taken from highs and swing lows from lows, which are the same series when only closing prices are used
+func findDivergences(highs, lows, indicator []float64, dates []time.Time, order, K, tolerance int) []Divergence {
+	highPeaks := getPeaks(highs, order, K)
+	lowPeaks := getPeaks(lows, order, K)
+	indicatorHighs := boolRelExtrema(indicator, order, func(a, b float64) bool { return a < b })
+	indicatorLows := boolRelExtrema(indicator, order, func(a, b float64) bool { return a > b })
+
+	divergences := []Divergence{}
+
+	// the divergence is confirmed once all indicator pivots that could be paired with the price pivot are known
+	for i := 0; i+tolerance < len(dates); i++ {
+		if dataLow, ok := lowPeaks["lows"][i]; ok {
+			if d, ok := pairPeak(true, dataLow, lows, indicator, indicatorLows, dates, i+tolerance, tolerance); ok {
+				divergences = append(divergences, d)
+			}
+		}
 
-	// Save the plot to a file or display it
-	if err := p.Save(6*vg.Inch, 4*vg.Inch, "rsi.png"); err != nil {
-		log.Fatal(err)
+		if dataHigh, ok := highPeaks["highs"][i]; ok {
+			if d, ok := pairPeak(false, dataHigh, highs, indicator, indicatorHighs, dates, i+tolerance, tolerance); ok {
+				divergences = append(divergences, d)
+			}
+		}
 	}
 
-	fmt.Println("Plot saved as rsi.png")
+	return divergences
 }
 
-func plotLocalHighsAndLows(data []float64, dates []time.Time, order int) {
-	maxIdx := boolRelExtrema(data, order, func(a, b float64) bool { return a > b })
-	minIdx := boolRelExtrema(data, order, func(a, b float64) bool { return a < b })
-
-	p := plot.New()
-
-	p.Title.Text = "Maxima and Minima Points"
-	p.X.Label.Text = "Date"
-	p.Y.Label.Text = "Price ($)"
-
-	// Plot the close prices
-	ptsClose := make(plotter.XYs, len(data))
-	for i := range data {
-		ptsClose[i].X = float64(i)
-		ptsClose[i].Y = data[i]
+func pairPeak(isLow bool, dataPeak peak, data, indicator []float64, indicatorPivots []int, dates []time.Time, confirmation, tolerance int) (Divergence, bool) {
+	positions, ok := alignPivots(dataPeak.pivots, indicatorPivots, tolerance)
+	if !ok {
+		return Divergence{}, false
 	}
+	indicatorPeak := [2]int{indicatorPivots[positions[0]], indicatorPivots[positions[1]]}
 
-	lineClose, err := plotter.NewLine(ptsClose)
-	if err != nil {
-		log.Fatal(err)
+	kind, direction, ok := classify(isLow, dataPeak.trend, trendOf(indicator[indicatorPeak[0]], indicator[indicatorPeak[1]]))
+	if !ok {
+		return Divergence{}, false
 	}
-	lineClose.Color = color.RGBA{0, 0, 0, 255}
-	p.Add(lineClose)
-
-	// Define colors for maxima and minima points
-	maximaColor := color.RGBA{255, 0, 0, 255} // Red
-	minimaColor := color.RGBA{0, 0, 255, 255} // Blue
-
-	// Plot maxima points
-	plotMaxima(p, maxIdx, dates, data, maximaColor)
 
-	// Plot minima points
-	plotMinima(p, minIdx, dates, data, minimaColor)
-
-	// Add a legend
-	p.Legend.Add("Close", lineClose)
-
-	// Save the plot to a file or display it
-	if err := p.Save(6*vg.Inch, 4*vg.Inch, "maxima_minima.png"); err != nil {
-		log.Fatal(err)
-	}
-
-	fmt.Println("Plot saved as maxima_minima.png")
-}
-
-func plotDivergence(p *plot.Plot, indices [][]int, dates []time.Time, close []float64, c color.Color) {
-	for _, group := range indices {
-		pts := make(plotter.XYs, len(group))
-		for i, idx := range group {
-			pts[i].X = float64(idx)
-			pts[i].Y = close[idx]
-		}
-		line, err := plotter.NewLine(pts)
-		if err != nil {
-			log.Fatal(err)
-		}
-		line.Color = c
-		p.Add(line)
-	}
+	return newDivergence(kind, direction, confirmation, dataPeak.pivots, indicatorPeak, data, indicator, dates), true
 }
 
-func plotMaxima(p *plot.Plot, indices []int, dates []time.Time, close []float64, c color.Color) {
-	pts := make(plotter.XYs, len(indices))
-	for i, idx := range indices {
-		pts[i].X = float64(idx)
-		pts[i].Y = close[idx]
+func newDivergence(kind Kind, direction Direction, confirmation int, dataPivots, indicatorPivots [2]int, data, indicator []float64, dates []time.Time) Divergence {
+	d := Divergence{
+		Kind:              kind,
+		Direction:         direction,
+		ConfirmationIndex: confirmation,
+		ConfirmationTime:  dates[confirmation],
 	}
-	s, err := plotter.NewScatter(pts)
-	if err != nil {
-		log.Fatal(err)
+	for n := 0; n < 2; n++ {
+		d.PricePivots[n] = Pivot{Index: dataPivots[n], Time: dates[dataPivots[n]], Value: data[dataPivots[n]]}
+		d.IndicatorPivots[n] = Pivot{Index: indicatorPivots[n], Time: dates[indicatorPivots[n]], Value: indicator[indicatorPivots[n]]}
+		d.Offsets[n] = indicatorPivots[n] - dataPivots[n]
 	}
-	s.GlyphStyle.Color = c
-	s.GlyphStyle.Radius = vg.Points(5)
-	p.Add(s)
-}
 
-func plotMinima(p *plot.Plot, indices []int, dates []time.Time, close []float64, c color.Color) {
-	pts := make(plotter.XYs, len(indices))
-	for i, idx := range indices {
-		pts[i].X = float64(idx)
-		pts[i].Y = close[idx]
-	}
-	s, err := plotter.NewScatter(pts)
-	if err != nil {
-		log.Fatal(err)
-	}
-	s.GlyphStyle.Color = c
-	s.GlyphStyle.Radius = vg.Points(5)
-	p.Add(s)
+	return d
 }
 
-func getPeaks(data []float64, order, K int) map[string][]float64 {
-	hhIndex := getHHIndex(data, order, K)
-	lhIndex := getLHIndex(data, order, K)
-	llIndex := getLLIndex(data, order, K)
-	hlIndex := getHLIndex(data, order, K)
-
-	dataWithPeaks := make(map[string][]float64)
+// peak marks the bar on which a chain of higher (trend 1) or lower (trend -1) pivots is confirmed
+type peak struct {
+	trend  int
+	pivots [2]int
+}
 
-	//create dataWithPeaks["highs"] and dataWithPeaks["lows"] with NaN values length of data
-	dataWithPeaks["highs"] = make([]float64, len(data))
-	dataWithPeaks["lows"] = make([]float64, len(data))
+func getPeaks(data []float64, order, K int) map[string]map[int]peak {
+	dataWithPeaks := make(map[string]map[int]peak)
+	dataWithPeaks["highs"] = make(map[int]peak)
+	dataWithPeaks["lows"] = make(map[int]peak)
 
-	for _, idx := range hhIndex {
-		dataWithPeaks["highs"][idx] = 1
+	for idx, pivots := range getHHIndex(data, order, K) {
+		dataWithPeaks["highs"][idx] = peak{trend: 1, pivots: pivots}
 	}
-	for _, idx := range lhIndex {
-		dataWithPeaks["highs"][idx] = -1
+	for idx, pivots := range getLHIndex(data, order, K) {
+		dataWithPeaks["highs"][idx] = peak{trend: -1, pivots: pivots}
 	}
 
-	for _, idx := range llIndex {
-		dataWithPeaks["lows"][idx] = -1
+	for idx, pivots := range getLLIndex(data, order, K) {
+		dataWithPeaks["lows"][idx] = peak{trend: -1, pivots: pivots}
 	}
-	for _, idx := range hlIndex {
-		dataWithPeaks["lows"][idx] = 1
+	for idx, pivots := range getHLIndex(data, order, K) {
+		dataWithPeaks["lows"][idx] = peak{trend: 1, pivots: pivots}
 	}
 
 	return dataWithPeaks
 }
 
-func getHHIndex(data []float64, order, K int) []int {
+func getHHIndex(data []float64, order, K int) map[int][2]int {
 	extrema := getHigherHighs(data, order, K)
 	logger.Debug("higher high extrema: ", extrema)
-	var idx []int
-	for _, i := range extrema {
-		if i[len(i)-1]+order < len(data) {
-			idx = append(idx, i[len(i)-1]+order)
-		}
-	}
+	idx := getConfirmationIndex(extrema, order, len(data))
 	logger.Debug("higher high idx: ", idx)
 	return idx
 }
 
-func getLHIndex(data []float64, order, K int) []int {
+func getLHIndex(data []float64, order, K int) map[int][2]int {
 	extrema := getLowerHighs(data, order, K)
 	logger.Debug("lower high extrema: ", extrema)
-	var idx []int
-	for _, i := range extrema {
-		if i[len(i)-1]+order < len(data) {
-			idx = append(idx, i[len(i)-1]+order)
-		}
-	}
+	idx := getConfirmationIndex(extrema, order, len(data))
 	logger.Debug("lower high idx: ", idx)
 	return idx
 }
 
-func getLLIndex(data []float64, order, K int) []int {
+func getLLIndex(data []float64, order, K int) map[int][2]int {
 	extrema := getLowerLows(data, order, K)
-
 	logger.Debug("lower low extrema: ", extrema)
-	var idx []int
-	for _, i := range extrema {
-		if i[len(i)-1]+order < len(data) {
-			idx = append(idx, i[len(i)-1]+order)
-		}
-	}
+	idx := getConfirmationIndex(extrema, order, len(data))
 	logger.Debug("lower low idx: ", idx)
 	return idx
 }
 
-func getHLIndex(data []float64, order, K int) []int {
+func getHLIndex(data []float64, order, K int) map[int][2]int {
 	extrema := getHigherLows(data, order, K)
-	var idx []int
 	logger.Debug("higher low extrema: ", extrema)
+	idx := getConfirmationIndex(extrema, order, len(data))
+	logger.Debug("higher low idx: ", idx)
+	return idx
+}
+
+// getConfirmationIndex maps the bar on which the last pivot of a chain is confirmed to the last two pivots of the chain
+func getConfirmationIndex(extrema [][]int, order, length int) map[int][2]int {
+	idx := make(map[int][2]int)
 	for _, i := range extrema {
-		if i[len(i)-1]+order < len(data) {
-			idx = append(idx, i[len(i)-1]+order)
+		if len(i) < 2 {
+			continue
+		}
+		if i[len(i)-1]+order < length {
+			idx[i[len(i)-1]+order] = [2]int{i[len(i)-2], i[len(i)-1]}
 		}
 	}
-	logger.Debug("higher low idx: ", idx)
 	return idx
 }
 
@@ -361,10 +184,7 @@ func getHigherHighs(data []float64, order, K int) [][]int {
 		}
 	}
 
-	if len(current) > 0 {
-		result = append(result, current)
-	}
-
+	// a chain still shorter than K at the end of the data is not a trend yet
 	return result
 }
 
@@ -403,10 +223,7 @@ func getLowerHighs(data []float64, order, K int) [][]int {
 		}
 	}
 
-	if len(current) > 0 {
-		result = append(result, current)
-	}
-
+	// a chain still shorter than K at the end of the data is not a trend yet
 	return result
 }
 
@@ -445,10 +262,7 @@ func getLowerLows(data []float64, order, K int) [][]int {
 		}
 	}
 
-	if len(current) > 0 {
-		result = append(result, current)
-	}
-
+	// a chain still shorter than K at the end of the data is not a trend yet
 	return result
 }
 
@@ -487,10 +301,7 @@ func getHigherLows(data []float64, order, K int) [][]int {
 		}
 	}
 
-	if len(current) > 0 {
-		result = append(result, current)
-	}
-
+	// a chain still shorter than K at the end of the data is not a trend yet
 	return result
 }
 
@@ -0,0 +1,145 @@
+package divergence_detection
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/divergence/pkg/models"
+)
+
+// Timeframe holds the candles of a symbol on one interval
+type Timeframe struct {
+	// Interval is the length of the candles. 0 uses the interval of the asset
+	Interval time.Duration
+	Asset    models.Asset
+}
+
+// Confluence is a divergence on a lower timeframe whose second price pivot lies within the bar of the
+// second price pivot of a divergence in the same direction on a higher timeframe
+type Confluence struct {
+	HigherInterval time.Duration
+	Higher         Divergence
+	LowerInterval  time.Duration
+	Lower          Divergence
+}
+
+// MultiTimeframeResult holds the divergences found on every timeframe and where they agree
+type MultiTimeframeResult struct {
+	Divergences map[time.Duration][]Divergence
+	Confluences []Confluence
+}
+
+// DetectMultiTimeframe detects divergences on every timeframe and pairs them across timeframes. The
+// timeframes are clipped to the time range all of them cover and Window counts candles of the highest
+// timeframe, so every timeframe is scanned over the same period. The indices of the divergences still count
+// from the first candle of the asset of their timeframe
+func (d *Detector) DetectMultiTimeframe(timeframes []Timeframe) (MultiTimeframeResult, error) {
+	result := MultiTimeframeResult{Divergences: make(map[time.Duration][]Divergence)}
+
+	sorted := make([]Timeframe, len(timeframes))
+	copy(sorted, timeframes)
+	for i := range sorted {
+		if sorted[i].Interval == 0 {
+			sorted[i].Interval = sorted[i].Asset.Interval
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Interval > sorted[j].Interval })
+
+	for i, timeframe := range sorted {
+		if timeframe.Interval <= 0 {
+			return result, fmt.Errorf("interval must be > 0, got %v", timeframe.Interval)
+		}
+		if i > 0 && sorted[i-1].Interval == timeframe.Interval {
+			return result, fmt.Errorf("interval %v given more than once", timeframe.Interval)
+		}
+	}
+	if len(sorted) == 0 {
+		return result, nil
+	}
+
+	from, to, err := commonRange(sorted)
+	if err != nil {
+		return result, err
+	}
+	if d.config.Window > 0 {
+		if start := to.Add(-time.Duration(d.config.Window) * sorted[0].Interval); start.After(from) {
+			from = start
+		}
+	}
+
+	// the window is applied to the range already, on the lower timeframes it would cut the range short
+	config := d.config
+	config.Window = 0
+	detector := &Detector{config: config}
+	for _, timeframe := range sorted {
+		first, _ := timeframe.Asset.Index(from)
+		end, _ := timeframe.Asset.Index(to)
+		divergences, err := detector.DetectAsset(timeframe.Asset.Slice(first, end))
+		if err != nil {
+			return result, fmt.Errorf("%v timeframe: %w", timeframe.Interval, err)
+		}
+		for i := range divergences {
+			divergences[i].Shift(first)
+		}
+		result.Divergences[timeframe.Interval] = divergences
+	}
+
+	for i, higher := range sorted {
+		for _, lower := range sorted[i+1:] {
+			result.Confluences = append(result.Confluences, findConfluences(
+				higher.Interval, result.Divergences[higher.Interval],
+				lower.Interval, result.Divergences[lower.Interval],
+			)...)
+		}
+	}
+
+	return result, nil
+}
+
+// commonRange returns the time range the candles of every timeframe cover, from the latest first candle up
+// to the earliest end of a last candle
+func commonRange(timeframes []Timeframe) (time.Time, time.Time, error) {
+	var from, to time.Time
+	for i, timeframe := range timeframes {
+		dates := timeframe.Asset.Date
+		if len(dates) == 0 {
+			return from, to, fmt.Errorf("%v timeframe has no candles", timeframe.Interval)
+		}
+		first, end := dates[0], dates[len(dates)-1].Add(timeframe.Interval)
+		if i == 0 || first.After(from) {
+			from = first
+		}
+		if i == 0 || end.Before(to) {
+			to = end
+		}
+	}
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("the timeframes do not overlap, the latest starts at %v after the earliest ends at %v", from, to)
+	}
+	return from, to, nil
+}
+
+func findConfluences(higherInterval time.Duration, higher []Divergence, lowerInterval time.Duration, lower []Divergence) []Confluence {
+	var confluences []Confluence
+
+	for _, h := range higher {
+		barStart := h.PricePivots[1].Time
+		barEnd := barStart.Add(higherInterval)
+
+		for _, l := range lower {
+			pivot := l.PricePivots[1].Time
+			if l.Direction != h.Direction || pivot.Before(barStart) || !pivot.Before(barEnd) {
+				continue
+			}
+			confluences = append(confluences, Confluence{
+				HigherInterval: higherInterval,
+				Higher:         h,
+				LowerInterval:  lowerInterval,
+				Lower:          l,
+			})
+		}
+	}
+
+	return confluences
+}
@@ -0,0 +1,143 @@
+package divergence_detection
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/divergence/pkg/models"
+)
+
+// testTimeframes returns the 4h candles of the test data and the 12h candles resampled from them
+func testTimeframes(t *testing.T) (models.Asset, models.Asset) {
+	t.Helper()
+	candles := loadCandles(t)
+	higher, err := models.Resample(candles, models.ResampleConfig{Interval: 12 * time.Hour, DropPartial: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lower := models.AssetFromCandles(candles)
+	lower.Interval = 4 * time.Hour
+	asset := models.AssetFromCandles(higher)
+	asset.Interval = 12 * time.Hour
+	return lower, asset
+}
+
+func detectTimeframes(t *testing.T, config DetectorConfig, timeframes ...models.Asset) MultiTimeframeResult {
+	t.Helper()
+	detector, err := NewDetector(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var input []Timeframe
+	for _, asset := range timeframes {
+		input = append(input, Timeframe{Asset: asset})
+	}
+	result, err := detector.DetectMultiTimeframe(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// checkIndices fails when a divergence does not index the candles of asset
+func checkIndices(t *testing.T, asset models.Asset, divergences []Divergence) {
+	t.Helper()
+	for _, d := range divergences {
+		for _, pivot := range append(d.PricePivots[:], d.IndicatorPivots[:]...) {
+			if !asset.Date[pivot.Index].Equal(pivot.Time) {
+				t.Fatalf("%v timeframe: pivot at %v has index %d, which opens at %v", asset.Interval, pivot.Time, pivot.Index, asset.Date[pivot.Index])
+			}
+		}
+	}
+}
+
+func TestDetectMultiTimeframeConfluence(t *testing.T) {
+	lower, higher := testTimeframes(t)
+
+	result := detectTimeframes(t, DefaultDetectorConfig(), lower, higher)
+	checkIndices(t, lower, result.Divergences[4*time.Hour])
+	checkIndices(t, higher, result.Divergences[12*time.Hour])
+
+	// the 4h low of 2024-11-04 20:00 lies within the 12h bar of the higher low of 2024-11-04 12:00
+	if len(result.Confluences) != 1 {
+		t.Fatalf("got %d confluences, want 1", len(result.Confluences))
+	}
+	c := result.Confluences[0]
+	if c.HigherInterval != 12*time.Hour || c.LowerInterval != 4*time.Hour {
+		t.Errorf("confluence of %v and %v, want 12h and 4h", c.HigherInterval, c.LowerInterval)
+	}
+	if c.Higher.Kind != Hidden || c.Higher.Direction != Bullish || c.Lower.Direction != Bullish {
+		t.Errorf("confluence of a %s and a %s divergence, want a hidden bullish one on 12h", c.Higher.Type(), c.Lower.Type())
+	}
+	higherPivot := time.Date(2024, 11, 4, 12, 0, 0, 0, time.UTC)
+	lowerPivot := time.Date(2024, 11, 4, 20, 0, 0, 0, time.UTC)
+	if !c.Higher.PricePivots[1].Time.Equal(higherPivot) || !c.Lower.PricePivots[1].Time.Equal(lowerPivot) {
+		t.Errorf("pivots at %v and %v, want %v and %v", c.Higher.PricePivots[1].Time, c.Lower.PricePivots[1].Time, higherPivot, lowerPivot)
+	}
+}
+
+func TestDetectMultiTimeframeClips(t *testing.T) {
+	lower, higher := testTimeframes(t)
+	config := DefaultDetectorConfig()
+	config.Order = 2
+
+	tests := []struct {
+		name     string
+		window   int
+		lower    models.Asset
+		from, to time.Time
+	}{
+		// the 4h candles start later, the 12h ones are only scanned from there
+		{"shorter timeframe", 0, lower.Slice(200, lower.Len()), lower.Date[200], higher.Date[higher.Len()-1].Add(12 * time.Hour)},
+		// the window counts 12h candles, the 4h timeframe covers the same 50 days
+		{"window", 100, lower, higher.Date[higher.Len()-100], higher.Date[higher.Len()-1].Add(12 * time.Hour)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config.Window = test.window
+			result := detectTimeframes(t, config, test.lower, higher)
+
+			config.Window = 0
+			for _, asset := range []models.Asset{test.lower, higher} {
+				clipped := asset.Between(test.from, test.to)
+				want := detectTimeframes(t, config, clipped).Divergences[asset.Interval]
+				first, _ := asset.Index(test.from)
+				for i := range want {
+					want[i].Shift(first)
+				}
+				got := result.Divergences[asset.Interval]
+				if len(want) == 0 || !reflect.DeepEqual(got, want) {
+					t.Errorf("%v timeframe: got %d divergences, want the %d of %v to %v", asset.Interval, len(got), len(want), test.from, test.to)
+				}
+				checkIndices(t, asset, got)
+			}
+		})
+	}
+}
+
+func TestDetectMultiTimeframeErrors(t *testing.T) {
+	lower, higher := testTimeframes(t)
+	detector, err := NewDetector(DefaultDetectorConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		timeframes []Timeframe
+	}{
+		{"no overlap", []Timeframe{{Asset: lower.Slice(0, 200)}, {Asset: higher.Between(lower.Date[250], lower.Date[lower.Len()-1])}}},
+		{"same interval", []Timeframe{{Asset: lower}, {Asset: lower}}},
+		{"no interval", []Timeframe{{Asset: models.Asset{Closing: lower.Closing, Date: lower.Date}}}},
+		{"no candles", []Timeframe{{Asset: lower}, {Interval: 12 * time.Hour}}},
+		{"too few candles in the range", []Timeframe{{Asset: lower.Slice(0, 100)}, {Asset: higher.Slice(32, higher.Len())}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := detector.DetectMultiTimeframe(test.timeframes); err == nil {
+				t.Error("no error")
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package divergence_detection
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/divergence/pkg/models"
+	"github.com/markcheno/go-talib"
+)
+
+// Oscillator is the indicator price is compared against
+type Oscillator interface {
+	Name() string
+	// WarmUp is the number of leading bars without a valid value
+	WarmUp() int
+	// Compute returns one value for every candle in asset
+	Compute(asset models.Asset) ([]float64, error)
+}
+
+// RSI is the Relative Strength Index
+type RSI struct {
+	Period int
+}
+
+func (o RSI) Name() string { return fmt.Sprintf("RSI(%d)", o.Period) }
+func (o RSI) WarmUp() int  { return o.Period }
+
+func (o RSI) Compute(asset models.Asset) ([]float64, error) {
+	if err := checkPeriods(o, o.Period); err != nil {
+		return nil, err
+	}
+	return talib.Rsi(asset.Closing, o.Period), nil
+}
+
+// MACD is the histogram of the Moving Average Convergence Divergence
+type MACD struct {
+	Fast   int
+	Slow   int
+	Signal int
+}
+
+func (o MACD) Name() string { return fmt.Sprintf("MACD(%d,%d,%d)", o.Fast, o.Slow, o.Signal) }
+func (o MACD) WarmUp() int  { return o.Slow + o.Signal - 2 }
+
+func (o MACD) Compute(asset models.Asset) ([]float64, error) {
+	if err := checkPeriods(o, o.Fast, o.Slow, o.Signal); err != nil {
+		return nil, err
+	}
+	if o.Fast >= o.Slow {
+		return nil, fmt.Errorf("%s: fast period has to be smaller than slow period", o.Name())
+	}
+	_, _, histogram := talib.Macd(asset.Closing, o.Fast, o.Slow, o.Signal)
+	return histogram, nil
+}
+
+// Stochastic is the %K line of the Stochastic Oscillator, smoothed over Smoothing bars
+type Stochastic struct {
+	Period    int
+	Smoothing int
+}
+
+func (o Stochastic) Name() string { return fmt.Sprintf("Stochastic(%d,%d)", o.Period, o.Smoothing) }
+func (o Stochastic) WarmUp() int  { return o.Period + o.Smoothing - 2 }
+
+func (o Stochastic) Compute(asset models.Asset) ([]float64, error) {
+	if err := checkPeriods(o, o.Period, o.Smoothing); err != nil {
+		return nil, err
+	}
+	if err := checkSeries(o, asset, asset.High, asset.Low); err != nil {
+		return nil, err
+	}
+	k, _ := talib.Stoch(asset.High, asset.Low, asset.Closing, o.Period, o.Smoothing, talib.SMA, 1, talib.SMA)
+	return k, nil
+}
+
+// CCI is the Commodity Channel Index
+type CCI struct {
+	Period int
+}
+
+func (o CCI) Name() string { return fmt.Sprintf("CCI(%d)", o.Period) }
+func (o CCI) WarmUp() int  { return o.Period - 1 }
+
+func (o CCI) Compute(asset models.Asset) ([]float64, error) {
+	if err := checkPeriods(o, o.Period); err != nil {
+		return nil, err
+	}
+	if err := checkSeries(o, asset, asset.High, asset.Low); err != nil {
+		return nil, err
+	}
+	return talib.Cci(asset.High, asset.Low, asset.Closing, o.Period), nil
+}
+
+// MFI is the Money Flow Index
+type MFI struct {
+	Period int
+}
+
+func (o MFI) Name() string { return fmt.Sprintf("MFI(%d)", o.Period) }
+func (o MFI) WarmUp() int  { return o.Period }
+
+func (o MFI) Compute(asset models.Asset) ([]float64, error) {
+	if err := checkPeriods(o, o.Period); err != nil {
+		return nil, err
+	}
+	if err := checkSeries(o, asset, asset.High, asset.Low, asset.Volume); err != nil {
+		return nil, err
+	}
+	return talib.Mfi(asset.High, asset.Low, asset.Closing, asset.Volume, o.Period), nil
+}
+
+// OBV is the On Balance Volume
+type OBV struct{}
+
+func (o OBV) Name() string { return "OBV" }
+func (o OBV) WarmUp() int  { return 0 }
+
+func (o OBV) Compute(asset models.Asset) ([]float64, error) {
+	if err := checkSeries(o, asset, asset.Volume); err != nil {
+		return nil, err
+	}
+	return talib.Obv(asset.Closing, asset.Volume), nil
+}
+
+// OpenInterest compares price with the open interest of a perpetual, which has to be merged into the candles
+type OpenInterest struct{}
+
+func (o OpenInterest) Name() string { return "OpenInterest" }
+func (o OpenInterest) WarmUp() int  { return 0 }
+
+func (o OpenInterest) Compute(asset models.Asset) ([]float64, error) {
+	if err := checkSeries(o, asset, asset.OpenInterest); err != nil {
+		return nil, err
+	}
+	for _, value := range asset.OpenInterest {
+		if value != 0 {
+			return asset.OpenInterest, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: asset has no open interest", o.Name())
+}
+
+// WilliamsR is Williams %R
+type WilliamsR struct {
+	Period int
+}
+
+func (o WilliamsR) Name() string { return fmt.Sprintf("WilliamsR(%d)", o.Period) }
+func (o WilliamsR) WarmUp() int  { return o.Period - 1 }
+
+func (o WilliamsR) Compute(asset models.Asset) ([]float64, error) {
+	if err := checkPeriods(o, o.Period); err != nil {
+		return nil, err
+	}
+	if err := checkSeries(o, asset, asset.High, asset.Low); err != nil {
+		return nil, err
+	}
+	return talib.WillR(asset.High, asset.Low, asset.Closing, o.Period), nil
+}
+
+func checkPeriods(o Oscillator, periods ...int) error {
+	for _, period := range periods {
+		if period < 1 {
+			return fmt.Errorf("%s: periods must be >= 1", o.Name())
+		}
+	}
+	return nil
+}
+
+// checkSeries makes sure the series the oscillator needs besides the closing prices are loaded
+func checkSeries(o Oscillator, asset models.Asset, series ...[]float64) error {
+	for _, s := range series {
+		if len(s) != len(asset.Closing) {
+			return fmt.Errorf("%s: asset has %d closing prices but %d values in a required series", o.Name(), len(asset.Closing), len(s))
+		}
+	}
+	return nil
+}
+
+// OscillatorByName returns the oscillator called rsi, macd, stochastic, cci, mfi, obv, williamsr or oi.
+// period is used by the oscillators that take one, MACD and the smoothing of Stochastic use their usual settings
+func OscillatorByName(name string, period int) (Oscillator, error) {
+	var oscillator Oscillator
+	switch strings.ToLower(name) {
+	case "rsi":
+		oscillator = RSI{Period: period}
+	case "macd":
+		oscillator = MACD{Fast: 12, Slow: 26, Signal: 9}
+	case "stochastic", "stoch":
+		oscillator = Stochastic{Period: period, Smoothing: 3}
+	case "cci":
+		oscillator = CCI{Period: period}
+	case "mfi":
+		oscillator = MFI{Period: period}
+	case "obv":
+		oscillator = OBV{}
+	case "williamsr", "willr":
+		oscillator = WilliamsR{Period: period}
+	case "oi", "openinterest":
+		oscillator = OpenInterest{}
+	default:
+		return nil, fmt.Errorf("unknown oscillator %q", name)
+	}
+	return oscillator, nil
+}
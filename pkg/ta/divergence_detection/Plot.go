@@ -0,0 +1,176 @@
+package divergence_detection
+
+import (
+	"fmt"
+	"image/color"
+	"path/filepath"
+	"strings"
+
+	"github.com/divergence/pkg/models"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+)
+
+// PlotDivergences plots the pivots and the trend lines of price and oscillator within the window of config
+// into dir and returns the paths of the charts
+func PlotDivergences(asset models.Asset, config DetectorConfig, dir string) ([]string, error) {
+	if config.Window > 0 && config.Window < asset.Len() {
+		asset = asset.Slice(asset.Len()-config.Window, asset.Len())
+	}
+
+	indicator, err := config.Oscillator.Compute(asset)
+	if err != nil {
+		return nil, err
+	}
+
+	// remove the warm-up elements from the array, because we don't have oscillator values for them
+	warmUp := min(config.Oscillator.WarmUp(), asset.Len())
+	paths := []string{}
+	path, err := plotLocalHighsAndLows(asset.Closing[warmUp:], config.Order, dir)
+	if err != nil {
+		return paths, err
+	}
+	paths = append(paths, path)
+
+	path, err = plotDivergence2(asset.Closing[warmUp:], "trend_lines_price", config.Order, dir)
+	if err != nil {
+		return paths, err
+	}
+	paths = append(paths, path)
+
+	// the file is named after the oscillator without its periods, like trend_lines_rsi
+	name, _, _ := strings.Cut(config.Oscillator.Name(), "(")
+	path, err = plotDivergence2(indicator[warmUp:], "trend_lines_"+strings.ToLower(name), config.Order, dir)
+	if err != nil {
+		return paths, err
+	}
+	return append(paths, path), nil
+}
+
+func plotDivergence2(data []float64, title string, order int, dir string) (string, error) {
+	p := plot.New()
+
+	p.Title.Text = title
+	p.X.Label.Text = "Date"
+	p.Y.Label.Text = "Price ($)"
+
+	// Plot the close prices
+	lineClose, err := plotter.NewLine(linePoints(data))
+	if err != nil {
+		return "", fmt.Errorf("plotting %s: %w", title, err)
+	}
+	lineClose.Color = color.RGBA{0, 0, 0, 255}
+	p.Add(lineClose)
+
+	// Define colors for different divergence points
+	colors := []color.Color{
+		color.RGBA{0, 0, 0, 255},     // Close
+		color.RGBA{255, 0, 0, 255},   // Higher Highs
+		color.RGBA{0, 255, 0, 255},   // Higher Lows
+		color.RGBA{0, 0, 255, 255},   // Lower Lows
+		color.RGBA{255, 0, 255, 255}, // Lower Highs
+	}
+
+	// Plot different divergence points
+	chains := [][][]int{
+		getHigherHighs(data, order, 2),
+		getHigherLows(data, order, 2),
+		getLowerLows(data, order, 2),
+		getLowerHighs(data, order, 2),
+	}
+	for i, chain := range chains {
+		if err := plotDivergence(p, chain, data, colors[i+1]); err != nil {
+			return "", fmt.Errorf("plotting %s: %w", title, err)
+		}
+	}
+
+	// Add a legend
+	p.Legend.Add("Close", lineClose)
+
+	path := filepath.Join(dir, fmt.Sprintf("%s.png", title))
+	if err := p.Save(6*vg.Inch, 4*vg.Inch, path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func plotLocalHighsAndLows(data []float64, order int, dir string) (string, error) {
+	maxIdx := boolRelExtrema(data, order, func(a, b float64) bool { return a > b })
+	minIdx := boolRelExtrema(data, order, func(a, b float64) bool { return a < b })
+
+	p := plot.New()
+
+	p.Title.Text = "Maxima and Minima Points"
+	p.X.Label.Text = "Date"
+	p.Y.Label.Text = "Price ($)"
+
+	// Plot the close prices
+	lineClose, err := plotter.NewLine(linePoints(data))
+	if err != nil {
+		return "", fmt.Errorf("plotting maxima and minima: %w", err)
+	}
+	lineClose.Color = color.RGBA{0, 0, 0, 255}
+	p.Add(lineClose)
+
+	// Plot maxima in red and minima in blue
+	if err := plotPoints(p, maxIdx, data, color.RGBA{255, 0, 0, 255}); err != nil {
+		return "", fmt.Errorf("plotting maxima: %w", err)
+	}
+	if err := plotPoints(p, minIdx, data, color.RGBA{0, 0, 255, 255}); err != nil {
+		return "", fmt.Errorf("plotting minima: %w", err)
+	}
+
+	// Add a legend
+	p.Legend.Add("Close", lineClose)
+
+	path := filepath.Join(dir, "maxima_minima.png")
+	if err := p.Save(6*vg.Inch, 4*vg.Inch, path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// linePoints places data on the x axis by index
+func linePoints(data []float64) plotter.XYs {
+	pts := make(plotter.XYs, len(data))
+	for i := range data {
+		pts[i].X = float64(i)
+		pts[i].Y = data[i]
+	}
+	return pts
+}
+
+func plotDivergence(p *plot.Plot, indices [][]int, close []float64, c color.Color) error {
+	for _, group := range indices {
+		pts := make(plotter.XYs, len(group))
+		for i, idx := range group {
+			pts[i].X = float64(idx)
+			pts[i].Y = close[idx]
+		}
+		line, err := plotter.NewLine(pts)
+		if err != nil {
+			return err
+		}
+		line.Color = c
+		p.Add(line)
+	}
+	return nil
+}
+
+func plotPoints(p *plot.Plot, indices []int, close []float64, c color.Color) error {
+	pts := make(plotter.XYs, len(indices))
+	for i, idx := range indices {
+		pts[i].X = float64(idx)
+		pts[i].Y = close[idx]
+	}
+	s, err := plotter.NewScatter(pts)
+	if err != nil {
+		return err
+	}
+	s.GlyphStyle.Color = c
+	s.GlyphStyle.Radius = vg.Points(5)
+	p.Add(s)
+	return nil
+}
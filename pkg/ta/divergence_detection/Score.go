@@ -0,0 +1,163 @@
+package divergence_detection
+
+import (
+	"fmt"
+	"math"
+)
+
+// Score rates how significant a divergence is. All components and the total range from 0 to 1
+type Score struct {
+	// Slope grows with how far price and indicator move apart between their pivots
+	Slope float64
+	// Distance is highest for pivots that are neither too close nor too far apart
+	Distance float64
+	// Zone is highest when the indicator is oversold for bullish and overbought for bearish divergences
+	Zone float64
+	// Prominence grows with how far the price pivots stand out from the bars around them
+	Prominence float64
+
+	Total float64
+}
+
+// ScoreConfig weights the components of the Score. The weights do not need to add up to 1
+type ScoreConfig struct {
+	SlopeWeight      float64
+	DistanceWeight   float64
+	ZoneWeight       float64
+	ProminenceWeight float64
+	// MaxDistance is the number of bars between the price pivots at which a divergence is considered stale
+	MaxDistance int
+}
+
+// Leveled is implemented by oscillators with fixed oversold and overbought levels
+type Leveled interface {
+	Levels() (oversold, overbought float64)
+}
+
+func (o RSI) Levels() (float64, float64)        { return 30, 70 }
+func (o Stochastic) Levels() (float64, float64) { return 20, 80 }
+func (o CCI) Levels() (float64, float64)        { return -100, 100 }
+func (o MFI) Levels() (float64, float64)        { return 20, 80 }
+func (o WilliamsR) Levels() (float64, float64)  { return -80, -20 }
+
+func DefaultScoreConfig() ScoreConfig {
+	return ScoreConfig{
+		SlopeWeight:      1,
+		DistanceWeight:   1,
+		ZoneWeight:       1,
+		ProminenceWeight: 1,
+		MaxDistance:      60,
+	}
+}
+
+func (c ScoreConfig) validate(order int) error {
+	if c.SlopeWeight < 0 || c.DistanceWeight < 0 || c.ZoneWeight < 0 || c.ProminenceWeight < 0 {
+		return fmt.Errorf("score weights must be >= 0")
+	}
+	if c.SlopeWeight+c.DistanceWeight+c.ZoneWeight+c.ProminenceWeight == 0 {
+		return fmt.Errorf("at least one score weight must be > 0")
+	}
+	if c.MaxDistance <= 3*order {
+		return fmt.Errorf("max distance must be > 3 * order (%d), got %d", 3*order, c.MaxDistance)
+	}
+	return nil
+}
+
+// scoreDivergence rates d on the bars around its pivots. prices holds the lows for bullish and the highs
+// for bearish divergences, the value of bar i is at prices[i-offset]
+func scoreDivergence(d Divergence, prices, indicator []float64, offset, order int, oscillator Oscillator, config ScoreConfig) Score {
+	from := min(d.PricePivots[0].Index, d.IndicatorPivots[0].Index) - order
+	to := max(d.PricePivots[1].Index, d.IndicatorPivots[1].Index) + order
+	from = max(from, offset) - offset
+	to = min(to, offset+len(prices)-1) - offset
+
+	priceLow, priceHigh := rangeOf(prices[from : to+1])
+	indicatorLow, indicatorHigh := rangeOf(indicator[from : to+1])
+
+	var score Score
+
+	// both moves are measured over the same bars, so comparing the changes compares the slopes
+	priceMove := ratio(d.PricePivots[1].Value-d.PricePivots[0].Value, priceHigh-priceLow)
+	indicatorMove := ratio(d.IndicatorPivots[1].Value-d.IndicatorPivots[0].Value, indicatorHigh-indicatorLow)
+	score.Slope = clamp(math.Abs(priceMove) + math.Abs(indicatorMove))
+
+	// 0 at order bars, 1 from 3 * order bars and back to 0 at the max distance
+	bars := d.PricePivots[1].Index - d.PricePivots[0].Index
+	rising := float64(bars-order) / float64(2*order)
+	falling := float64(config.MaxDistance-bars) / float64(config.MaxDistance-3*order)
+	score.Distance = clamp(math.Min(rising, falling))
+
+	prominence := 0.0
+	for _, pivot := range d.PricePivots {
+		prominence += pivotProminence(prices, pivot.Index-offset, order, d.Direction == Bullish)
+	}
+	// a pivot standing out by half of the range is as prominent as it gets
+	score.Prominence = clamp(ratio(prominence, priceHigh-priceLow))
+
+	weights := config.SlopeWeight + config.DistanceWeight + config.ProminenceWeight
+	total := score.Slope*config.SlopeWeight + score.Distance*config.DistanceWeight + score.Prominence*config.ProminenceWeight
+
+	// oscillators without levels are rated without the zone
+	if leveled, ok := oscillator.(Leveled); ok {
+		oversold, overbought := leveled.Levels()
+		score.Zone = zoneScore(d, oversold, overbought)
+		weights += config.ZoneWeight
+		total += score.Zone * config.ZoneWeight
+	}
+
+	if weights > 0 {
+		score.Total = total / weights
+	}
+
+	return score
+}
+
+// zoneScore is 1 beyond the level and falls to 0 in the middle between both levels
+func zoneScore(d Divergence, oversold, overbought float64) float64 {
+	middle := (oversold + overbought) / 2
+	if d.Direction == Bullish {
+		extreme := math.Min(d.IndicatorPivots[0].Value, d.IndicatorPivots[1].Value)
+		return clamp((middle - extreme) / (middle - oversold))
+	}
+
+	extreme := math.Max(d.IndicatorPivots[0].Value, d.IndicatorPivots[1].Value)
+	return clamp((extreme - middle) / (overbought - middle))
+}
+
+// pivotProminence is the smaller of the moves away from the pivot on its left and its right within order bars
+func pivotProminence(prices []float64, i, order int, isLow bool) float64 {
+	left, right := 0.0, 0.0
+	for j := max(i-order, 0); j <= min(i+order, len(prices)-1); j++ {
+		move := prices[i] - prices[j]
+		if isLow {
+			move = -move
+		}
+		if j < i {
+			left = math.Max(left, move)
+		}
+		if j > i {
+			right = math.Max(right, move)
+		}
+	}
+	return math.Min(left, right)
+}
+
+func rangeOf(data []float64) (float64, float64) {
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, value := range data {
+		low = math.Min(low, value)
+		high = math.Max(high, value)
+	}
+	return low, high
+}
+
+func ratio(a, b float64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return a / b
+}
+
+func clamp(value float64) float64 {
+	return math.Max(0, math.Min(1, value))
+}
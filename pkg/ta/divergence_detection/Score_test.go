@@ -0,0 +1,157 @@
+package divergence_detection
+
+import (
+	"math"
+	"testing"
+
+	"github.com/divergence/pkg/models"
+)
+
+// testPivots returns a divergence with its price and indicator pivots on the bars of indices
+func testPivots(direction Direction, prices, indicator []float64, indices [2]int) Divergence {
+	d := Divergence{Direction: direction}
+	for n, i := range indices {
+		d.PricePivots[n] = Pivot{Index: i, Value: prices[i]}
+		d.IndicatorPivots[n] = Pivot{Index: i, Value: indicator[i]}
+	}
+	return d
+}
+
+func TestScoreDivergence(t *testing.T) {
+	// a lower low at 8 on bar 12 after 10 on bar 4, while the RSI rises from 25 to 30. The bars 2 to 14 range
+	// from 8 to 20 in price and from 25 to 55 in the RSI
+	prices := []float64{20, 20, 13, 12, 10, 14, 17, 20, 19, 16, 13, 11, 8, 12, 15, 18, 20}
+	indicator := []float64{50, 50, 40, 35, 25, 35, 45, 55, 50, 45, 40, 35, 30, 38, 45, 50, 50}
+	d := testPivots(Bullish, prices, indicator, [2]int{4, 12})
+	config := ScoreConfig{SlopeWeight: 1, DistanceWeight: 1, ZoneWeight: 1, ProminenceWeight: 1, MaxDistance: 30}
+
+	// the price falls by 2/12 of its range and the RSI rises by 5/30 of its range
+	slope := 2/12.0 + 5/30.0
+	// 8 bars apart, falling from 1 at 6 bars to 0 at 30 bars
+	distance := 22 / 24.0
+	// the first pivot stands out by 3, the second by 5, out of a range of 12
+	prominence := 8 / 12.0
+
+	tests := []struct {
+		name       string
+		oscillator Oscillator
+		config     ScoreConfig
+		want       Score
+	}{
+		// the RSI low of 25 is beyond the oversold level
+		{"rsi", RSI{Period: 14}, config, Score{Slope: slope, Distance: distance, Zone: 1, Prominence: prominence, Total: (slope + distance + 1 + prominence) / 4}},
+		{"without levels", OBV{}, config, Score{Slope: slope, Distance: distance, Prominence: prominence, Total: (slope + distance + prominence) / 3}},
+		{"weighted", RSI{Period: 14}, ScoreConfig{SlopeWeight: 3, ZoneWeight: 1, MaxDistance: 30}, Score{Slope: slope, Distance: distance, Zone: 1, Prominence: prominence, Total: (3*slope + 1) / 4}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := scoreDivergence(d, prices, indicator, 0, 2, test.oscillator, test.config)
+			for _, c := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"slope", got.Slope, test.want.Slope},
+				{"distance", got.Distance, test.want.Distance},
+				{"zone", got.Zone, test.want.Zone},
+				{"prominence", got.Prominence, test.want.Prominence},
+				{"total", got.Total, test.want.Total},
+			} {
+				if math.Abs(c.got-c.want) > 1e-9 {
+					t.Errorf("%s is %v, want %v", c.name, c.got, c.want)
+				}
+			}
+		})
+	}
+
+	// the bars are passed from bar 2 on
+	shifted := scoreDivergence(d, prices[2:], indicator[2:], 2, 2, RSI{Period: 14}, config)
+	if want := scoreDivergence(d, prices, indicator, 0, 2, RSI{Period: 14}, config); shifted != want {
+		t.Errorf("with an offset got %+v, want %+v", shifted, want)
+	}
+}
+
+func TestScoreDistance(t *testing.T) {
+	flat := make([]float64, 80)
+	config := ScoreConfig{SlopeWeight: 1, MaxDistance: 30}
+
+	tests := []struct {
+		bars     int
+		distance float64
+	}{
+		{2, 0},
+		{4, 0.5},
+		{6, 1},
+		{18, 0.5},
+		{30, 0},
+		{40, 0},
+	}
+	for _, test := range tests {
+		d := testPivots(Bullish, flat, flat, [2]int{10, 10 + test.bars})
+		if got := scoreDivergence(d, flat, flat, 0, 2, RSI{Period: 14}, config); math.Abs(got.Distance-test.distance) > 1e-9 {
+			t.Errorf("%d bars apart: distance %v, want %v", test.bars, got.Distance, test.distance)
+		}
+	}
+}
+
+func TestZoneScore(t *testing.T) {
+	tests := []struct {
+		direction Direction
+		values    [2]float64
+		zone      float64
+	}{
+		{Bullish, [2]float64{25, 35}, 1},
+		{Bullish, [2]float64{45, 40}, 0.5},
+		{Bullish, [2]float64{50, 55}, 0},
+		{Bullish, [2]float64{60, 65}, 0},
+		{Bearish, [2]float64{80, 75}, 1},
+		{Bearish, [2]float64{55, 60}, 0.5},
+		{Bearish, [2]float64{45, 40}, 0},
+	}
+	for _, test := range tests {
+		d := Divergence{Direction: test.direction}
+		d.IndicatorPivots[0].Value, d.IndicatorPivots[1].Value = test.values[0], test.values[1]
+		if got := zoneScore(d, 30, 70); math.Abs(got-test.zone) > 1e-9 {
+			t.Errorf("%v at %v: zone %v, want %v", test.direction, test.values, got, test.zone)
+		}
+	}
+}
+
+func TestMinScore(t *testing.T) {
+	asset := models.AssetFromCandles(loadCandles(t))
+	detect := func(minScore float64) []Divergence {
+		t.Helper()
+		config := DefaultDetectorConfig()
+		config.MinScore = minScore
+		detector, err := NewDetector(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		divergences, err := detector.DetectAsset(asset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return divergences
+	}
+
+	all := detect(0)
+	const minScore = 0.5
+	want := []Divergence{}
+	for _, d := range all {
+		if d.Score.Total >= minScore {
+			want = append(want, d)
+		}
+	}
+	if len(want) == 0 || len(want) == len(all) {
+		t.Fatalf("%d of %d divergences score at least %v, want some but not all", len(want), len(all), minScore)
+	}
+
+	got := detect(minScore)
+	if len(got) != len(want) {
+		t.Fatalf("got %d divergences, want the %d scoring at least %v", len(got), len(want), minScore)
+	}
+	for i := range got {
+		if got[i].ConfirmationIndex != want[i].ConfirmationIndex || got[i].Score != want[i].Score {
+			t.Errorf("divergence %d confirmed on bar %d with %v, want bar %d with %v", i, got[i].ConfirmationIndex, got[i].Score.Total, want[i].ConfirmationIndex, want[i].Score.Total)
+		}
+	}
+}
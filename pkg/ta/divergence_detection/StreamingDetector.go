@@ -0,0 +1,325 @@
+package divergence_detection
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/divergence/pkg/models"
+)
+
+// StreamingDetector finds divergences between price and the RSI on candles that arrive one at a time.
+// It keeps only the state needed for the next candle, so memory does not grow with the number of candles.
+// Indices in the returned divergences count the candles pushed so far, starting at 0.
+type StreamingDetector struct {
+	config DetectorConfig
+	rsi    rollingRSI
+
+	// start is the first bar on which pivots are searched
+	start int
+	bars  int
+
+	// the bars still needed for finding and scoring pivots, starting with bar first
+	first     int
+	highs     []float64
+	lows      []float64
+	indicator []float64
+	dates     []time.Time
+
+	priceHighs chainTracker
+	priceLows  chainTracker
+
+	// indicator pivots that can still be paired with a price pivot
+	indicatorHighs []Pivot
+	indicatorLows  []Pivot
+
+	// completed price chains waiting for the indicator pivots within the alignment tolerance
+	pendingHighs []pivotPair
+	pendingLows  []pivotPair
+}
+
+// NewStreamingDetector accepts the same config as NewDetector, but only with an RSI oscillator. Window is ignored
+func NewStreamingDetector(config DetectorConfig) (*StreamingDetector, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid detector config: %w", err)
+	}
+
+	rsi, ok := config.Oscillator.(RSI)
+	if !ok {
+		return nil, fmt.Errorf("streaming detection only supports RSI, got %s", config.Oscillator.Name())
+	}
+	if rsi.Period < 2 {
+		return nil, fmt.Errorf("RSI period must be >= 2, got %d", rsi.Period)
+	}
+
+	s := &StreamingDetector{
+		config:     config,
+		rsi:        rollingRSI{period: rsi.Period},
+		priceHighs: chainTracker{length: config.ChainLength},
+		priceLows:  chainTracker{length: config.ChainLength},
+	}
+	if config.TrimWarmUp {
+		s.start = rsi.Period
+	}
+
+	return s, nil
+}
+
+// Push adds the next candle and returns the divergences confirmed by it
+func (s *StreamingDetector) Push(candle models.Candle) []Divergence {
+	high, low := candle.Close, candle.Close
+	if s.config.PriceMode == WickPrice {
+		high, low = candle.High, candle.Low
+	}
+	if s.config.PriceMode == BodyPrice {
+		high, low = math.Max(candle.Open, candle.Close), math.Min(candle.Open, candle.Close)
+	}
+
+	bar := s.bars
+	s.bars++
+	rsi := s.rsi.update(candle.Close)
+
+	if bar < s.start {
+		s.first = bar + 1
+		return nil
+	}
+
+	s.highs = append(s.highs, high)
+	s.lows = append(s.lows, low)
+	s.indicator = append(s.indicator, rsi)
+	s.dates = append(s.dates, candle.StartTime())
+
+	size := 2*s.config.Order + 1
+	if bar-s.start+1 < size {
+		return nil
+	}
+
+	// the candidate has order bars on both sides now, so it is confirmed on this bar
+	candidate := bar - s.config.Order
+	middle := candidate - s.first
+	window := len(s.dates) - size
+	date := s.dates[middle]
+
+	if isWindowExtrema(s.highs[window:], s.config.Order, func(a, b float64) bool { return a < b }) {
+		if pair := s.priceHighs.add(Pivot{Index: candidate, Time: date, Value: s.highs[middle]}); pair.trend != 0 {
+			s.pendingHighs = append(s.pendingHighs, pair)
+		}
+	}
+	if isWindowExtrema(s.lows[window:], s.config.Order, func(a, b float64) bool { return a > b }) {
+		if pair := s.priceLows.add(Pivot{Index: candidate, Time: date, Value: s.lows[middle]}); pair.trend != 0 {
+			s.pendingLows = append(s.pendingLows, pair)
+		}
+	}
+	if isWindowExtrema(s.indicator[window:], s.config.Order, func(a, b float64) bool { return a < b }) {
+		s.indicatorHighs = append(s.indicatorHighs, Pivot{Index: candidate, Time: date, Value: s.indicator[middle]})
+	}
+	if isWindowExtrema(s.indicator[window:], s.config.Order, func(a, b float64) bool { return a > b }) {
+		s.indicatorLows = append(s.indicatorLows, Pivot{Index: candidate, Time: date, Value: s.indicator[middle]})
+	}
+
+	// all indicator pivots up to tolerance bars after the oldest pending price pivot are known now
+	var divergences []Divergence
+	ready := bar - s.config.Order - s.config.AlignmentTolerance
+	for len(s.pendingLows) > 0 && s.pendingLows[0].pivots[1].Index <= ready {
+		if d, ok := s.pair(true, s.pendingLows[0], s.indicatorLows, bar, candle.StartTime()); ok {
+			divergences = append(divergences, d)
+		}
+		s.pendingLows = s.pendingLows[1:]
+	}
+	for len(s.pendingHighs) > 0 && s.pendingHighs[0].pivots[1].Index <= ready {
+		if d, ok := s.pair(false, s.pendingHighs[0], s.indicatorHighs, bar, candle.StartTime()); ok {
+			divergences = append(divergences, d)
+		}
+		s.pendingHighs = s.pendingHighs[1:]
+	}
+
+	oldestHigh := s.oldestNeeded(s.priceHighs, s.pendingHighs)
+	oldestLow := s.oldestNeeded(s.priceLows, s.pendingLows)
+	s.indicatorHighs = prunePivots(s.indicatorHighs, oldestHigh)
+	s.indicatorLows = prunePivots(s.indicatorLows, oldestLow)
+	s.pruneBars(min(oldestHigh, oldestLow, bar-size+1) - s.config.Order)
+
+	return divergences
+}
+
+// pruneBars drops the bars before bar oldest
+func (s *StreamingDetector) pruneBars(oldest int) {
+	drop := min(max(oldest-s.first, 0), len(s.dates))
+	s.highs = s.highs[drop:]
+	s.lows = s.lows[drop:]
+	s.indicator = s.indicator[drop:]
+	s.dates = s.dates[drop:]
+	s.first += drop
+}
+
+func (s *StreamingDetector) pair(isLow bool, price pivotPair, indicatorPivots []Pivot, bar int, date time.Time) (Divergence, bool) {
+	candidates := make([]int, len(indicatorPivots))
+	for i, pivot := range indicatorPivots {
+		candidates[i] = pivot.Index
+	}
+
+	positions, ok := alignPivots([2]int{price.pivots[0].Index, price.pivots[1].Index}, candidates, s.config.AlignmentTolerance)
+	if !ok {
+		return Divergence{}, false
+	}
+	indicator := [2]Pivot{indicatorPivots[positions[0]], indicatorPivots[positions[1]]}
+
+	kind, direction, ok := classify(isLow, price.trend, trendOf(indicator[0].Value, indicator[1].Value))
+	if !ok {
+		return Divergence{}, false
+	}
+
+	d := Divergence{
+		Kind:              kind,
+		Direction:         direction,
+		Indicator:         s.config.Oscillator.Name(),
+		PricePivots:       price.pivots,
+		IndicatorPivots:   indicator,
+		Offsets:           [2]int{indicator[0].Index - price.pivots[0].Index, indicator[1].Index - price.pivots[1].Index},
+		ConfirmationIndex: bar,
+		ConfirmationTime:  date,
+	}
+
+	prices := s.lows
+	if !isLow {
+		prices = s.highs
+	}
+	if s.config.CleanLines && !hasCleanLines(d, prices, s.indicator, s.first, s.config.LineTolerance) {
+		return Divergence{}, false
+	}
+
+	d.Score = scoreDivergence(d, prices, s.indicator, s.first, s.config.Order, s.config.Oscillator, s.config.Score)
+
+	return d, d.Score.Total >= s.config.MinScore
+}
+
+// oldestNeeded is the first bar an indicator pivot can be on and still be paired with a future price chain
+func (s *StreamingDetector) oldestNeeded(chain chainTracker, pending []pivotPair) int {
+	oldest := math.MaxInt
+	if len(pending) > 0 {
+		oldest = pending[0].pivots[0].Index
+	}
+	// the next chain starts at the last price pivot
+	if chain.previous != nil && chain.previous.Index < oldest {
+		oldest = chain.previous.Index
+	}
+	if oldest == math.MaxInt {
+		return 0
+	}
+	return oldest - s.config.AlignmentTolerance
+}
+
+func prunePivots(pivots []Pivot, oldest int) []Pivot {
+	for len(pivots) > 0 && pivots[0].Index < oldest {
+		pivots = pivots[1:]
+	}
+	return pivots
+}
+
+// isWindowExtrema is the streaming version of boolRelExtrema for a single bar
+func isWindowExtrema(window []float64, i int, comparator func(float64, float64) bool) bool {
+	for j := range window {
+		if j != i && comparator(window[i], window[j]) {
+			return false
+		}
+	}
+	return true
+}
+
+// chainTracker follows the pivots of one series like getHigherHighs and friends, but one pivot at a time.
+// It tracks the higher and the lower chain together, as a pivot can only continue one of them
+type chainTracker struct {
+	length int
+
+	previous *Pivot
+	rising   []Pivot
+	falling  []Pivot
+}
+
+// pivotPair holds the last two pivots of a completed chain of higher (trend 1) or lower (trend -1) pivots
+type pivotPair struct {
+	trend  int
+	pivots [2]Pivot
+}
+
+// add returns the chain completed by pivot, which has no trend when no chain of length pivots was completed
+func (c *chainTracker) add(pivot Pivot) pivotPair {
+	defer func() { c.previous = &pivot }()
+
+	if c.previous == nil {
+		c.rising = []Pivot{pivot}
+		c.falling = []Pivot{pivot}
+		return pivotPair{}
+	}
+
+	if pivot.Value > c.previous.Value {
+		c.falling = nil
+		return c.extend(&c.rising, pivot, 1)
+	}
+	if pivot.Value < c.previous.Value {
+		c.rising = nil
+		return c.extend(&c.falling, pivot, -1)
+	}
+
+	c.rising, c.falling = nil, nil
+	return pivotPair{}
+}
+
+func (c *chainTracker) extend(chain *[]Pivot, pivot Pivot, trend int) pivotPair {
+	if len(*chain) == 0 {
+		*chain = append(*chain, *c.previous)
+	}
+	*chain = append(*chain, pivot)
+
+	if len(*chain) < c.length {
+		return pivotPair{}
+	}
+
+	p := pivotPair{trend: trend, pivots: [2]Pivot{(*chain)[len(*chain)-2], (*chain)[len(*chain)-1]}}
+	*chain = nil
+	return p
+}
+
+// rollingRSI computes the same values as talib.Rsi, one closing price at a time
+type rollingRSI struct {
+	period    int
+	count     int
+	prevClose float64
+	avgGain   float64
+	avgLoss   float64
+}
+
+func (r *rollingRSI) update(close float64) float64 {
+	defer func() { r.prevClose = close; r.count++ }()
+
+	if r.count == 0 {
+		return 0
+	}
+
+	gain, loss := 0.0, 0.0
+	if change := close - r.prevClose; change < 0 {
+		loss = -change
+	} else {
+		gain = change
+	}
+
+	if r.count < r.period {
+		r.avgGain += gain
+		r.avgLoss += loss
+		return 0
+	}
+
+	if r.count == r.period {
+		r.avgGain = (r.avgGain + gain) / float64(r.period)
+		r.avgLoss = (r.avgLoss + loss) / float64(r.period)
+	} else {
+		r.avgGain = (r.avgGain*float64(r.period-1) + gain) / float64(r.period)
+		r.avgLoss = (r.avgLoss*float64(r.period-1) + loss) / float64(r.period)
+	}
+
+	sum := r.avgGain + r.avgLoss
+	if -0.00000000000001 < sum && sum < 0.00000000000001 {
+		return 0
+	}
+	return 100 * (r.avgGain / sum)
+}
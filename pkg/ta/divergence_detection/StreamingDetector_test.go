@@ -0,0 +1,115 @@
+package divergence_detection
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/divergence/pkg/feed"
+	"github.com/divergence/pkg/logger"
+	"github.com/divergence/pkg/models"
+	"github.com/markcheno/go-talib"
+)
+
+func TestMain(m *testing.M) {
+	logger.SetDebug(false)
+	os.Exit(m.Run())
+}
+
+func loadCandles(t *testing.T) []*models.Candle {
+	t.Helper()
+	candles, err := feed.FileSource{Path: "../../../data/btc-4h.json", Format: feed.BybitFormat{}}.Candles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return candles
+}
+
+func TestRollingRSI(t *testing.T) {
+	candles := loadCandles(t)
+	closes := models.AssetFromCandles(candles).Closing
+
+	for _, period := range []int{2, 9, 14, 21} {
+		want := talib.Rsi(closes, period)
+		rsi := rollingRSI{period: period}
+		for i, price := range closes {
+			got := rsi.update(price)
+			if i < period {
+				continue
+			}
+			if math.Abs(got-want[i]) > 1e-9 {
+				t.Fatalf("period %d, bar %d: got %v, want %v", period, i, got, want[i])
+			}
+		}
+	}
+}
+
+func TestStreamingMatchesBatch(t *testing.T) {
+	candles := loadCandles(t)
+	asset := models.AssetFromCandles(candles)
+
+	tests := []struct {
+		order, k, tolerance int
+		mode                PriceMode
+	}{
+		{4, 2, 0, ClosePrice},
+		{4, 2, 0, WickPrice},
+		{3, 2, 0, BodyPrice},
+		{4, 2, 2, ClosePrice},
+		{4, 2, 2, WickPrice},
+		{3, 3, 0, ClosePrice},
+		{3, 3, 1, WickPrice},
+		{5, 3, 2, BodyPrice},
+		{2, 2, 1, ClosePrice},
+	}
+	for _, test := range tests {
+		name := fmt.Sprintf("order=%d/k=%d/tolerance=%d/%v", test.order, test.k, test.tolerance, test.mode)
+		t.Run(name, func(t *testing.T) {
+			config := DefaultDetectorConfig()
+			config.Window = 0
+			config.Order = test.order
+			config.ChainLength = test.k
+			config.AlignmentTolerance = test.tolerance
+			config.PriceMode = test.mode
+
+			detector, err := NewDetector(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := detector.DetectAsset(asset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.SliceStable(want, func(i, j int) bool { return want[i].ConfirmationIndex < want[j].ConfirmationIndex })
+
+			streaming, err := NewStreamingDetector(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []Divergence{}
+			for i, candle := range candles {
+				for _, d := range streaming.Push(*candle) {
+					if d.ConfirmationIndex != i {
+						t.Errorf("divergence confirmed at %d emitted on bar %d", d.ConfirmationIndex, i)
+					}
+					got = append(got, d)
+				}
+			}
+
+			if len(want) == 0 {
+				t.Fatal("no divergences found")
+			}
+			if len(got) != len(want) {
+				t.Fatalf("streaming found %d divergences, batch %d", len(got), len(want))
+			}
+			for i := range want {
+				if !reflect.DeepEqual(got[i], want[i]) {
+					t.Errorf("divergence %d:\nstreaming %+v\nbatch     %+v", i, got[i], want[i])
+				}
+			}
+		})
+	}
+}
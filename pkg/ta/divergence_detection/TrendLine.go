@@ -0,0 +1,34 @@
+package divergence_detection
+
+// crossesLine tells if a bar between the two pivots lies beyond the line connecting them. For lows the line
+// is crossed from above and for highs from below. A bar may cross the line by tolerance times the range of
+// the series between the pivots. The value of bar i is at series[i-offset]
+func crossesLine(series []float64, pivots [2]Pivot, offset int, isLow bool, tolerance float64) bool {
+	first, second := pivots[0].Index-offset, pivots[1].Index-offset
+	if second-first < 2 {
+		return false
+	}
+
+	low, high := rangeOf(series[first : second+1])
+	allowed := tolerance * (high - low)
+	slope := (pivots[1].Value - pivots[0].Value) / float64(second-first)
+
+	for i := first + 1; i < second; i++ {
+		line := pivots[0].Value + slope*float64(i-first)
+		if isLow && series[i] < line-allowed {
+			return true
+		}
+		if !isLow && series[i] > line+allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasCleanLines tells if neither the price nor the indicator crosses the line between the pivots of d
+func hasCleanLines(d Divergence, prices, indicator []float64, offset int, tolerance float64) bool {
+	isLow := d.Direction == Bullish
+	return !crossesLine(prices, d.PricePivots, offset, isLow, tolerance) &&
+		!crossesLine(indicator, d.IndicatorPivots, offset, isLow, tolerance)
+}
@@ -0,0 +1,54 @@
+package divergence_detection
+
+import "testing"
+
+func TestCrossesLine(t *testing.T) {
+	// the line from 10 on bar 0 to 14 on bar 4 is at 11, 12 and 13 on the bars between
+	line := [2]Pivot{{Index: 0, Value: 10}, {Index: 4, Value: 14}}
+
+	tests := []struct {
+		name      string
+		series    []float64
+		pivots    [2]Pivot
+		offset    int
+		isLow     bool
+		tolerance float64
+		crosses   bool
+	}{
+		{"low above the line", []float64{10, 12, 13, 14, 14}, line, 0, true, 0, false},
+		{"low on the line", []float64{10, 11, 12, 13, 14}, line, 0, true, 0, false},
+		{"low crossed by one bar", []float64{10, 12, 11.5, 14, 14}, line, 0, true, 0, true},
+		{"low crossed within the tolerance", []float64{10, 12, 11.5, 14, 14}, line, 0, true, 0.2, false},
+		{"low crossed beyond the tolerance", []float64{10, 12, 11, 14, 14}, line, 0, true, 0.2, true},
+		{"high below the line", []float64{10, 10, 11, 12, 14}, line, 0, false, 0, false},
+		{"high crossed by one bar", []float64{10, 10, 12.5, 12, 14}, line, 0, false, 0, true},
+		{"adjacent pivots", []float64{10, 5, 14}, [2]Pivot{{Index: 0, Value: 10}, {Index: 1, Value: 5}}, 0, true, 0, false},
+		{"offset", []float64{10, 12, 11.5, 14, 14}, [2]Pivot{{Index: 100, Value: 10}, {Index: 104, Value: 14}}, 100, true, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := crossesLine(test.series, test.pivots, test.offset, test.isLow, test.tolerance); got != test.crosses {
+				t.Errorf("got %v, want %v", got, test.crosses)
+			}
+		})
+	}
+}
+
+func TestHasCleanLines(t *testing.T) {
+	prices := []float64{10, 12, 13, 14, 14}
+	clean := []float64{30, 32, 34, 36, 38}
+	crossed := []float64{30, 32, 20, 36, 38}
+	d := Divergence{Direction: Bullish}
+	d.PricePivots = [2]Pivot{{Index: 0, Value: 10}, {Index: 4, Value: 14}}
+	d.IndicatorPivots = [2]Pivot{{Index: 0, Value: 30}, {Index: 4, Value: 38}}
+
+	if !hasCleanLines(d, prices, clean, 0, 0) {
+		t.Error("lines that are not crossed are not clean")
+	}
+	if hasCleanLines(d, prices, crossed, 0, 0) {
+		t.Error("an indicator line crossed by one bar is clean")
+	}
+	if hasCleanLines(d, []float64{10, 12, 9, 14, 14}, clean, 0, 0) {
+		t.Error("a price line crossed by one bar is clean")
+	}
+}